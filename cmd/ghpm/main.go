@@ -9,7 +9,7 @@ import (
 
 func main() {
 	if err := cli.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "%s\n", cli.ErrorMessage(err))
+		os.Exit(cli.ExitCode(err))
 	}
 }
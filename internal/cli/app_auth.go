@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+var (
+	appIDFlag             string
+	appInstallationIDFlag string
+	appPrivateKeyFlag     string
+)
+
+// appSettings returns the GitHub App given with the --app-* flags, then the GHPM_APP_* environment variables.
+// configured is false when none of them is set: ghpm acts as a user
+func appSettings() (appID string, installationID string, privateKeyPath string, configured bool) {
+
+	appID = flagOrEnvironment(appIDFlag, config.AppIDEnvironmentVariable)
+	installationID = flagOrEnvironment(appInstallationIDFlag, config.AppInstallationIDEnvironmentVariable)
+	privateKeyPath = flagOrEnvironment(appPrivateKeyFlag, config.AppPrivateKeyEnvironmentVariable)
+
+	return appID, installationID, privateKeyPath, appID != "" || installationID != "" || privateKeyPath != ""
+}
+
+func flagOrEnvironment(flagValue string, environmentVariable string) string {
+
+	if flagValue != "" {
+		return flagValue
+	}
+
+	return os.Getenv(environmentVariable)
+}
+
+// appInstallationTokenSource builds the token source of the GitHub App installation configured with appSettings
+func appInstallationTokenSource(hostname string) (*ghpm.AppInstallationTokenSource, error) {
+
+	appID, installationID, privateKeyPath, _ := appSettings()
+
+	if appID == "" || installationID == "" || privateKeyPath == "" {
+		return nil, errors.New("acting as a GitHub App needs --app-id, --app-installation-id and --app-private-key, or their GHPM_APP_* environment variables")
+	}
+
+	parsedInstallationID, err := strconv.ParseInt(installationID, 10, 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("the installation ID must be a number, got %q", installationID)
+	}
+
+	pemBytes, err := os.ReadFile(privateKeyPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read the private key of the app: %w", err)
+	}
+
+	privateKey, err := ghpm.ParseAppPrivateKey(pemBytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", privateKeyPath, err)
+	}
+
+	return &ghpm.AppInstallationTokenSource{
+		AppID:          appID,
+		InstallationID: parsedInstallationID,
+		PrivateKey:     privateKey,
+		APIBaseURL:     apiBaseURL(hostname),
+		HTTPClient:     http.DefaultClient,
+	}, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&appIDFlag, "app-id", "", "act as this GitHub App instead of a user. Needs --app-installation-id and --app-private-key")
+	rootCmd.PersistentFlags().StringVar(&appInstallationIDFlag, "app-installation-id", "", "ID of the installation of the GitHub App, on your organization most often")
+	rootCmd.PersistentFlags().StringVar(&appPrivateKeyFlag, "app-private-key", "", "path of the .pem private key of the GitHub App")
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyOutput  outputOptions
+	applySummary string
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan file>",
+	Short: "Apply a plan saved by ghpm plan.",
+	Args:  cobra.ExactArgs(1),
+	Long: heredoc.Docf(`
+		Apply a plan saved by %[1]sghpm plan%[1]s.
+
+		Every repository is fetched again before being switched. If its visibility or its
+		fingerprint changed since planning, it drifted: it is skipped, never switched.
+		Plan again to include it.
+	`, "`"),
+	Example: heredoc.Doc(`
+		$ ghpm plan -o plan.json
+		$ ghpm apply plan.json
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		planFile, err := os.Open(args[0])
+
+		if err != nil {
+			return err
+		}
+
+		defer planFile.Close()
+
+		plan, err := ghpm.ReadPlan(planFile)
+
+		if err != nil {
+			return err
+		}
+
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+		if err != nil {
+			return err
+		}
+
+		results, err := ghPrivacyManager.ApplyPlan(cmd.Context(), plan)
+
+		if err != nil {
+			return err
+		}
+
+		return reportSwitch(cmd, results, applyOutput, applySummary, nil)
+	},
+}
+
+func init() {
+	addOutputFlags(applyCmd, &applyOutput, switchResultFields, defaultSwitchResultFields)
+	addSummaryFlag(applyCmd, &applySummary)
+	addSkipPolicyFlags(applyCmd)
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Inspect the authentication state of ghpm.",
+	Args:  cobra.NoArgs,
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows whether ghpm has a stored token and who it belongs to.",
+	Args:  cobra.NoArgs,
+	Long: heredoc.Docf(`
+		Shows whether ghpm has a stored token and who it belongs to.
+
+		The token is stored by %[1]sghpm login%[1]s and removed by %[1]sghpm logout%[1]s.
+		A token given with %[1]s--token%[1]s, %[1]s--with-token%[1]s or an environment variable
+		takes precedence over the stored one. With %[1]s--app-id%[1]s, ghpm acts as a GitHub App instead,
+		and shows the account the app is installed on.
+	`, "`"),
+	Example: heredoc.Doc(`
+		$ ghpm auth status
+
+		$ ghpm auth status --hostname github.example.com
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		hostname := currentHostname()
+
+		if _, _, _, configured := appSettings(); configured {
+			return appAuthStatus(cmd, hostname)
+		}
+
+		tokenPath, err := storedTokenPath()
+
+		if err != nil {
+			return err
+		}
+
+		if activeProfileName != "" {
+			fmt.Printf("profile: %s \n", activeProfileName)
+		}
+
+		token, source, err := nonInteractiveGithubAuthToken(cmd, hostname)
+
+		if errors.Is(err, config.ErrNoStoredToken) {
+
+			fmt.Printf("not logged in to %s. No token stored in %s \n", hostname, tokenPath)
+			fmt.Printf("run: ghpm login, or set one of %s \n", strings.Join(config.TokenEnvironmentVariables, ", "))
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ghPrivacyManager := ghpm.NewLazyGithubPrivacyManager(apiBaseURL(hostname), ghpm.StaticToken(token), http.DefaultClient)
+
+		if source == tokenSourceStored {
+			fmt.Printf("token stored in %s \n", tokenPath)
+		} else {
+			fmt.Printf("token read from %s \n", source)
+		}
+
+		fmt.Printf("token: %s \n", maskToken(token))
+
+		var missingScopes ghpm.ErrMissingScopes
+
+		err = ghPrivacyManager.Authenticate(cmd.Context())
+
+		switch {
+		case errors.Is(err, ghpm.ErrUnauthorized):
+
+			fmt.Println("the token was rejected by github. run: ghpm login")
+
+			return nil
+
+		case errors.As(err, &missingScopes):
+
+			fmt.Printf("%s. run: ghpm login, or create a token with the %s scope \n", missingScopes, strings.Join(missingScopes.Missing, ", "))
+
+			return nil
+
+		case err != nil:
+
+			return err
+		}
+
+		fmt.Printf("logged in to %s as %s \n", hostname, ghPrivacyManager.Username())
+
+		if scopes, known := ghPrivacyManager.Scopes(); known {
+			fmt.Printf("token scopes: %s \n", strings.Join(scopes, ", "))
+		} else {
+			fmt.Println("token scopes: none reported, a fine-grained token or a GitHub App token")
+		}
+
+		return nil
+	},
+}
+
+// appAuthStatus is auth status when ghpm acts as a GitHub App
+func appAuthStatus(cmd *cobra.Command, hostname string) error {
+
+	installation, err := appInstallationTokenSource(hostname)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("acting as the GitHub App %s, installation %d \n", installation.AppID, installation.InstallationID)
+
+	ghPrivacyManager := ghpm.NewLazyGithubPrivacyManager(apiBaseURL(hostname), installation, http.DefaultClient)
+
+	if err := ghPrivacyManager.Authenticate(cmd.Context()); err != nil {
+		return err
+	}
+
+	fmt.Printf("installed on %s, on %s \n", ghPrivacyManager.Username(), hostname)
+
+	return nil
+}
+
+// maskToken keeps only enough of the token to recognize it
+func maskToken(token string) string {
+
+	const visiblePrefixLength = 4
+
+	if len(token) <= visiblePrefixLength {
+		return "****"
+	}
+
+	return token[:visiblePrefixLength] + "****"
+}
+
+func init() {
+	authCmd.AddCommand(authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
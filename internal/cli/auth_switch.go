@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var authSwitchNone bool
+
+var authSwitchCmd = &cobra.Command{
+	Use:   "switch [profile]",
+	Short: "Change the profile the next commands use, or list the profiles.",
+	Args:  cobra.MaximumNArgs(1),
+	Long: heredoc.Docf(`
+		Change the profile the next commands use, or list the profiles.
+
+		A profile is one of your accounts: a personal account, a work account, a bot.
+		Each profile has its own host, token, default organization and skip policy, stored in
+		%[1]sprofiles.json%[1]s in your config directory. %[1]sghpm login --profile NAME%[1]s creates one.
+		Its %[1]sorganization%[1]s and %[1]sskip_policy%[1]s (same keys as in %[1]sconfig.json%[1]s) are edited in the file.
+
+		%[1]s--profile%[1]s and the %[1]sGHPM_PROFILE%[1]s environment variable choose a profile for a single command.
+		Without any profile, ghpm uses the tokens of %[1]sghpm login%[1]s and %[1]sconfig.json%[1]s, as before.
+	`, "`"),
+	Example: heredoc.Doc(`
+		# list the profiles, the active one is marked with *
+		$ ghpm auth switch
+
+		$ ghpm auth switch work
+
+		# back to no profile
+		$ ghpm auth switch --none
+
+		# a single command with another profile
+		$ ghpm --profile personal list_private
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		profiles, err := config.LoadProfiles()
+
+		if err != nil {
+			return err
+		}
+
+		if authSwitchNone {
+
+			if len(args) > 0 {
+				return errors.New("--none and a profile cannot be used together")
+			}
+
+			profiles.Active = ""
+
+			if err := config.SaveProfiles(profiles); err != nil {
+				return err
+			}
+
+			fmt.Println("no profile active anymore")
+
+			return nil
+		}
+
+		if len(args) == 0 {
+			return listProfiles(profiles)
+		}
+
+		profile, err := profiles.Profile(args[0])
+
+		if err != nil {
+			return fmt.Errorf("%w. Create it with: ghpm login --profile %s", err, args[0])
+		}
+
+		profiles.Active = args[0]
+
+		if err := config.SaveProfiles(profiles); err != nil {
+			return err
+		}
+
+		fmt.Printf("switched to the profile %s: %s \n", args[0], describeProfile(profile))
+
+		return nil
+	},
+}
+
+// listProfiles prints one profile per line, the active one marked with *
+func listProfiles(profiles config.Profiles) error {
+
+	if len(profiles.Profiles) == 0 {
+
+		fmt.Println("no profile yet. Create one with: ghpm login --profile NAME")
+
+		return nil
+	}
+
+	for _, name := range profiles.Names() {
+
+		marker := " "
+
+		if name == profiles.Active {
+			marker = "*"
+		}
+
+		fmt.Printf("%s %s: %s \n", marker, name, describeProfile(profiles.Profiles[name]))
+	}
+
+	return nil
+}
+
+// describeProfile : who, on which host, targeting what
+func describeProfile(profile config.Profile) string {
+
+	username := profile.Username
+
+	if username == "" {
+		username = "unknown user"
+	}
+
+	description := fmt.Sprintf("%s on %s", username, config.ResolveHostname(profile.Host))
+
+	if profile.Organization != "" {
+		description += fmt.Sprintf(", organization %s", profile.Organization)
+	}
+
+	if profile.OauthToken == "" {
+		description += ", logged out"
+	}
+
+	return description
+}
+
+func init() {
+	authSwitchCmd.Flags().BoolVar(&authSwitchNone, "none", false, "go back to no profile")
+	authCmd.AddCommand(authSwitchCmd)
+}
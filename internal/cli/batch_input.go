@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var inputFormats = []string{"text", "json"}
+
+// batchLine : one repository read by --from-file, and where it was read
+type batchLine struct {
+	// line number for text, element number for json. Starts at 1
+	number int
+
+	repositoryName string
+}
+
+// batchResult : what happened to the repository of one batchLine
+type batchResult struct {
+	line batchLine
+
+	result ghpm.SwitchResult
+}
+
+var batchResultFields = append(
+	[]field[batchResult]{
+		{"line", func(record batchResult) any { return record.line.number }},
+		{"input", func(record batchResult) any { return record.line.repositoryName }},
+		{"outcome", func(record batchResult) any { return record.result.Outcome }},
+		{"reason", func(record batchResult) any { return record.result.Reason }},
+	},
+	repositoryFieldsOf(func(record batchResult) ghpm.GithubRepository { return record.result.Repository })...,
+)
+
+var defaultBatchResultFields = []string{"line", "full_name", "outcome", "reason"}
+
+// readBatchFile reads --from-file, - being standard input
+func readBatchFile(cmd *cobra.Command, path string, format string) ([]batchLine, error) {
+
+	if path == "-" {
+		return readBatchLines(cmd.InOrStdin(), format)
+	}
+
+	batchFile, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer batchFile.Close()
+
+	lines, err := readBatchLines(batchFile, format)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return lines, nil
+}
+
+// readBatchLines reads repository names.
+// text: one owner/name per line, blank lines and # comments are ignored.
+// json: an array of "owner/name", or of objects with a full_name, like ghpm list_public --output json prints
+func readBatchLines(r io.Reader, format string) ([]batchLine, error) {
+
+	switch format {
+	case "text":
+
+		var lines []batchLine
+
+		scanner := bufio.NewScanner(r)
+
+		for number := 1; scanner.Scan(); number++ {
+
+			repositoryName, _, _ := strings.Cut(scanner.Text(), "#")
+
+			repositoryName = strings.TrimSpace(repositoryName)
+
+			if repositoryName == "" {
+				continue
+			}
+
+			lines = append(lines, batchLine{number: number, repositoryName: repositoryName})
+		}
+
+		return lines, scanner.Err()
+
+	case "json":
+
+		var elements []json.RawMessage
+
+		if err := json.NewDecoder(r).Decode(&elements); err != nil {
+			return nil, fmt.Errorf("expected a json array: %w", err)
+		}
+
+		lines := make([]batchLine, 0, len(elements))
+
+		for index, element := range elements {
+
+			var repositoryName string
+
+			if err := json.Unmarshal(element, &repositoryName); err != nil {
+
+				var object struct {
+					Fullname string `json:"full_name"`
+				}
+
+				if err := json.Unmarshal(element, &object); err != nil || object.Fullname == "" {
+					return nil, fmt.Errorf("element %d: expected \"owner/name\" or an object with a full_name", index+1)
+				}
+
+				repositoryName = object.Fullname
+			}
+
+			lines = append(lines, batchLine{number: index + 1, repositoryName: repositoryName})
+		}
+
+		return lines, nil
+
+	default:
+
+		return nil, fmt.Errorf("unknown input format %q, expected one of: %s", format, strings.Join(inputFormats, ", "))
+	}
+}
@@ -0,0 +1,648 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/Neal-C/ghpm/internal/ghpmtest"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// runGhpm runs ghpm against server, in a config directory of its own
+func runGhpm(t *testing.T, server *ghpmtest.Server, args ...string) (string, error) {
+
+	t.Setenv("GHPM_API_URL", server.URL)
+	t.Setenv("GHPM_TOKEN", server.Token())
+	t.Setenv("GHPM_CONFIG_DIR", t.TempDir())
+
+	return executeGhpm(args...)
+}
+
+// executeGhpm runs ghpm with the environment of the test as is, as a new invocation with a run ID of its own
+func executeGhpm(args ...string) (string, error) {
+
+	runID = ghpm.NewRunID()
+
+	resetFlags(rootCmd)
+
+	var stdout bytes.Buffer
+
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&bytes.Buffer{})
+	rootCmd.SetArgs(args)
+
+	err := rootCmd.Execute()
+
+	return stdout.String(), err
+}
+
+// resetFlags puts back the default of every flag of cmd and its subcommands: cobra keeps the values of the previous execution
+func resetFlags(cmd *cobra.Command) {
+
+	reset := func(flag *pflag.Flag) {
+
+		if fresh, ok := flag.Value.(*freshSlice); ok {
+			flag.Value = fresh.Value
+		}
+
+		// slices are appended to by Set once set, see pflag.SliceValue
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+
+			var values []string
+
+			if defaultValue := strings.Trim(flag.DefValue, "[]"); defaultValue != "" {
+				values = strings.Split(defaultValue, ",")
+			}
+
+			slice.Replace(values)
+
+			flag.Value = &freshSlice{Value: flag.Value, slice: slice}
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+
+		flag.Changed = false
+	}
+
+	cmd.PersistentFlags().VisitAll(reset)
+	cmd.Flags().VisitAll(reset)
+
+	for _, subcommand := range cmd.Commands() {
+		resetFlags(subcommand)
+	}
+}
+
+// freshSlice : a slice flag whose first Set replaces the default, as in a first execution.
+// pflag keeps in the value whether it was set, and appends to what a previous execution gave
+type freshSlice struct {
+	pflag.Value
+
+	slice pflag.SliceValue
+
+	set bool
+}
+
+func (self *freshSlice) Set(value string) error {
+
+	if !self.set {
+
+		self.set = true
+
+		return self.slice.Replace(strings.Split(value, ","))
+	}
+
+	for _, element := range strings.Split(value, ",") {
+		if err := self.slice.Append(element); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestListPublicRepositories(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Name: "secret", Private: true})
+
+	stdout, err := runGhpm(t, server, "list_public", "--output", "names")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != "octocat/hello\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+}
+
+func TestThanosSnapSummary(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Name: "archived", Archived: true})
+
+	summaryPath := filepath.Join(t.TempDir(), "summary.json")
+
+	_, err := runGhpm(t, server, "thanos_snap", "--summary-json", summaryPath)
+
+	if code := ExitCode(err); code != ExitPartialFailure {
+		t.Fatalf("exit code = %d (%v), want %d", code, err, ExitPartialFailure)
+	}
+
+	content, err := os.ReadFile(summaryPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summary summaryFile
+
+	if err := json.Unmarshal(content, &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Status != ghpm.SummaryStatusPartialFailure || len(summary.Switched) != 1 || len(summary.Failed) != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestMaxAttemptsAppliesToAuthentication(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.InjectFault(http.MethodGet, "/user", ghpmtest.Fault{Status: http.StatusBadGateway})
+
+	if _, err := runGhpm(t, server, "list_public", "--max-attempts", "1"); err == nil {
+		t.Fatal("err = nil, want the 502 of /user: --max-attempts 1 disables retries")
+	}
+}
+
+func TestWithTokenLeavesTheConfirmationOnStandardInput(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello-experiment"})
+
+	rootCmd.SetIn(strings.NewReader(server.Token() + "\ny\n"))
+
+	t.Cleanup(func() { rootCmd.SetIn(nil) })
+
+	if _, err := runGhpm(t, server, "switch_private", "--with-token", "--match", "*-experiment"); err != nil {
+		t.Fatal(err)
+	}
+
+	if repo, _ := server.Repository("octocat/hello-experiment"); !repo.Private {
+		t.Error("the repository was not switched, the confirmation was read along with the token")
+	}
+
+	if _, err := runGhpm(t, server, "switch_private", "--with-token", "--from-file", "-"); err == nil {
+		t.Error("err = nil, want --with-token refused with --from-file -")
+	}
+}
+
+func TestSwitchProtectedRepository(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "famous", Stars: 10})
+
+	summaryPath := filepath.Join(t.TempDir(), "summary.json")
+
+	_, err := runGhpm(t, server, "switch_private", "famous", "--summary-json", summaryPath)
+
+	if code := ExitCode(err); code != ExitProtectedRepository {
+		t.Fatalf("exit code = %d (%v), want %d when the repository named is refused", code, err, ExitProtectedRepository)
+	}
+
+	content, err := os.ReadFile(summaryPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summary summaryFile
+
+	if err := json.Unmarshal(content, &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Status != ghpm.SummaryStatusTotalFailure || len(summary.Refused) != 1 || len(summary.Skipped) != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// nothing to confirm, the refusal is still reported
+	_, err = runGhpm(t, server, "switch_private", "famous", "--match", "*-experiment")
+
+	if code := ExitCode(err); code != ExitProtectedRepository {
+		t.Errorf("exit code = %d (%v), want %d along with a pattern matching nothing", code, err, ExitProtectedRepository)
+	}
+
+	// selected by a pattern, leaving it out is what the skip policy is for
+	if _, err := runGhpm(t, server, "switch_private", "--match", "*", "--yes"); err != nil {
+		t.Errorf("err = %v, want none when the repository is only matched", err)
+	}
+}
+
+func TestListPublicRepositoriesAsGitHubApp(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Fullname: ghpmtest.APP_ORGANIZATION + "/site"})
+
+	privateKeyPath := filepath.Join(t.TempDir(), "app.pem")
+
+	if err := os.WriteFile(privateKeyPath, server.AppPrivateKey(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GHPM_APP_ID", ghpmtest.APP_ID)
+	t.Setenv("GHPM_APP_INSTALLATION_ID", strconv.Itoa(ghpmtest.INSTALLATION_ID))
+	t.Setenv("GHPM_APP_PRIVATE_KEY", privateKeyPath)
+
+	stdout, err := runGhpm(t, server, "list_public", "--output", "names")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != ghpmtest.APP_ORGANIZATION+"/site\n" {
+		t.Errorf("stdout = %q, want the repositories of the organization the app is installed on", stdout)
+	}
+}
+
+func TestProfile(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Fullname: "octo-org/site"})
+
+	t.Setenv("GHPM_API_URL", server.URL)
+	t.Setenv("GHPM_CONFIG_DIR", t.TempDir())
+
+	// the token must come from the profile
+	for _, environmentVariable := range config.TokenEnvironmentVariables {
+		t.Setenv(environmentVariable, "")
+	}
+
+	err := config.SaveProfiles(config.Profiles{Profiles: map[string]config.Profile{
+		"work": {OauthToken: server.Token(), Organization: "octo-org"},
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeGhpm("auth", "switch", "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := executeGhpm("list_public", "--output", "names")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != "octo-org/site\n" {
+		t.Errorf("stdout = %q, want the repositories of the organization of the profile", stdout)
+	}
+
+	profiles, err := config.LoadProfiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profiles.Active != "work" || profiles.Profiles["work"].Username != server.Username() {
+		t.Errorf("profiles = %+v, want work active and its username remembered", profiles)
+	}
+
+	t.Setenv(config.ProfileEnvironmentVariable, "personal")
+
+	if _, err := executeGhpm("list_public"); !errors.Is(err, config.ErrNoProfile) {
+		t.Errorf("err = %v, want ErrNoProfile", err)
+	}
+}
+
+func TestProfileTokenStaysOnItsHost(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	t.Setenv("GHPM_API_URL", server.URL)
+	t.Setenv("GHPM_CONFIG_DIR", t.TempDir())
+
+	for _, environmentVariable := range config.TokenEnvironmentVariables {
+		t.Setenv(environmentVariable, "")
+	}
+
+	err := config.SaveProfiles(config.Profiles{Profiles: map[string]config.Profile{
+		"personal": {Host: config.DefaultHostname, OauthToken: server.Token()},
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeGhpm("--profile", "personal", "list_public", "--hostname", "github.example.com"); err == nil {
+		t.Error("err = nil, want the host of the profile refused")
+	}
+
+	t.Setenv("GHPM_HOST", "github.example.com")
+
+	if _, err := executeGhpm("--profile", "personal", "logout"); err == nil {
+		t.Error("err = nil, want the host of the profile refused")
+	}
+
+	if requests := server.Requests(); len(requests) > 0 {
+		t.Errorf("requests = %v, want the token of the profile never sent", requests)
+	}
+
+	profiles, err := config.LoadProfiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profile := profiles.Profiles["personal"]; profile.OauthToken != server.Token() || profile.Host != config.DefaultHostname {
+		t.Errorf("profile = %+v, want it unchanged", profile)
+	}
+}
+
+func TestUndo(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+	otherServer := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	otherServer.AddRepository(ghpm.GithubRepository{Name: "hello", Private: true})
+
+	if _, err := runGhpm(t, server, "switch_private", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	// same owner/name, another host: not the repository the journal is about
+	t.Setenv("GHPM_API_URL", otherServer.URL)
+
+	if _, err := executeGhpm("undo"); err == nil {
+		t.Error("undo replayed the journal on another host")
+	}
+
+	if repo, _ := otherServer.Repository("octocat/hello"); repo.Visibility != "private" {
+		t.Errorf("the other server has %s, want private", repo.Visibility)
+	}
+
+	t.Setenv("GHPM_API_URL", server.URL)
+
+	if _, err := executeGhpm("undo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if repo, _ := server.Repository("octocat/hello"); repo.Visibility != "public" {
+		t.Fatalf("server has %s, want public again", repo.Visibility)
+	}
+
+	// the second undo must not revert the first one
+	if _, err := executeGhpm("undo"); err == nil {
+		t.Error("a second undo went through")
+	}
+
+	if repo, _ := server.Repository("octocat/hello"); repo.Visibility != "public" {
+		t.Errorf("server has %s after a second undo, want public", repo.Visibility)
+	}
+}
+
+func TestUndoLeavesRepositoriesAlreadyBackUnchanged(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	if _, err := runGhpm(t, server, "switch_private", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath, err := config.JournalPath()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journalEntries, err := ghpm.ReadJournal(journalPath)
+
+	if err != nil || len(journalEntries) != 1 {
+		t.Fatalf("journal = %+v, err = %v, want one entry", journalEntries, err)
+	}
+
+	if _, err := executeGhpm("switch_public", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := executeGhpm("undo", "--run", journalEntries[0].RunID, "--output", "json", "--fields", "full_name,outcome")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []map[string]any
+
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+
+	if len(results) != 1 || results[0]["outcome"] != string(ghpm.OutcomeSkipped) {
+		t.Errorf("results = %v, want hello left unchanged", results)
+	}
+}
+
+func TestUndoListFields(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	if _, err := runGhpm(t, server, "switch_private", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := executeGhpm("undo", "--list", "--output", "json", "--fields", "full_name,to")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []map[string]any
+
+	if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+		t.Fatalf("%s: %s", err, stdout)
+	}
+
+	if len(entries) != 1 || len(entries[0]) != 2 || entries[0]["full_name"] != "octocat/hello" || entries[0]["to"] != "private" {
+		t.Errorf("entries = %v, want the fields asked for", entries)
+	}
+
+	if _, err := executeGhpm("undo", "--list", "--fields", "outcome"); err == nil {
+		t.Error("err = nil, want outcome refused: journal entries have none")
+	}
+}
+
+func TestReconcileDryRunFields(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello-experiment"})
+
+	policyPath := filepath.Join(t.TempDir(), "ghpm.yaml")
+
+	policy := "rules:\n  - name: hide experiments\n    match:\n      name: \"*-experiment\"\n    visibility: private\n"
+
+	if err := os.WriteFile(policyPath, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := runGhpm(t, server, "reconcile", "-f", policyPath, "--dry-run", "--output", "csv", "--fields", "full_name,target_visibility")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != "full_name,target_visibility\noctocat/hello-experiment,private\n" {
+		t.Errorf("stdout = %q, want the fields asked for", stdout)
+	}
+
+	if repo, _ := server.Repository("octocat/hello-experiment"); repo.Private {
+		t.Error("a dry run switched the repository")
+	}
+}
+
+func TestSkipPolicyFlagsOnlyOnSwitches(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "famous", Stars: 3})
+
+	if _, err := runGhpm(t, server, "list_public", "--max-stars", "5"); err == nil {
+		t.Error("err = nil, want --max-stars refused by a listing, where it does nothing")
+	}
+
+	if _, err := runGhpm(t, server, "switch_private", "famous", "--max-stars", "5"); err != nil {
+		t.Fatal(err)
+	}
+
+	if repo, _ := server.Repository("octocat/famous"); !repo.Private {
+		t.Error("the repository was not switched, --max-stars was ignored")
+	}
+}
+
+func TestReadBatchLines(t *testing.T) {
+
+	for _, test := range []struct {
+		name    string
+		format  string
+		input   string
+		want    []batchLine
+		wantErr bool
+	}{
+		{name: "text", format: "text", input: "octocat/hello\n\n# a comment\n  octo-org/site  # trailing comment\nbare\n", want: []batchLine{{1, "octocat/hello"}, {4, "octo-org/site"}, {5, "bare"}}},
+		{name: "text without final newline", format: "text", input: "octocat/hello", want: []batchLine{{1, "octocat/hello"}}},
+		{name: "empty text", format: "text", input: ""},
+		{name: "json names", format: "json", input: `["octocat/hello", "bare"]`, want: []batchLine{{1, "octocat/hello"}, {2, "bare"}}},
+		{name: "json objects", format: "json", input: `[{"full_name": "octocat/hello", "visibility": "public"}, "octo-org/site"]`, want: []batchLine{{1, "octocat/hello"}, {2, "octo-org/site"}}},
+		{name: "json object without full_name", format: "json", input: `[{"name": "hello"}]`, wantErr: true},
+		{name: "json not an array", format: "json", input: `{"full_name": "octocat/hello"}`, wantErr: true},
+		{name: "unknown format", format: "yaml", input: "- octocat/hello\n", wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+
+			lines, err := readBatchLines(strings.NewReader(test.input), test.format)
+
+			if test.wantErr {
+
+				if err == nil {
+					t.Errorf("lines = %+v, want an error", lines)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(lines, test.want) {
+				t.Errorf("lines = %+v, want %+v", lines, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyRefusesDrift(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Name: "other"})
+
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+
+	if _, err := runGhpm(t, server, "plan", "-o", planPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// switched by someone else between plan and apply
+	if _, err := executeGhpm("switch_private", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := executeGhpm("apply", planPath, "--output", "csv", "--fields", "full_name,outcome")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != "full_name,outcome\noctocat/hello,skipped\noctocat/other,switched\n" {
+		t.Errorf("stdout = %q, want hello skipped as drifted, other switched", stdout)
+	}
+
+	patches := 0
+
+	for _, request := range server.Requests() {
+		if request == "PATCH /repos/octocat/hello" {
+			patches++
+		}
+	}
+
+	if patches != 1 {
+		t.Errorf("hello was patched %d times, want only by the switch before apply", patches)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello-experiment"})
+	server.AddRepository(ghpm.GithubRepository{Name: "showcase", Private: true, Topics: []string{"showcase"}})
+	server.AddRepository(ghpm.GithubRepository{Name: "famous-experiment", Stars: 10})
+	server.AddRepository(ghpm.GithubRepository{Name: "untouched"})
+
+	policyPath := filepath.Join(t.TempDir(), "ghpm.yaml")
+
+	policy := "rules:\n  - match:\n      topic: showcase\n    visibility: public\n  - match:\n      name: \"*-experiment\"\n    visibility: private\n"
+
+	if err := os.WriteFile(policyPath, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runGhpm(t, server, "reconcile", "-f", policyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for fullname, want := range map[string]string{
+		"octocat/hello-experiment": "private",
+		"octocat/showcase":         "public",
+		// the skip policy still applies
+		"octocat/famous-experiment": "public",
+		// no rule, ignored by default
+		"octocat/untouched": "public",
+	} {
+		if repo, _ := server.Repository(fullname); repo.Visibility != want {
+			t.Errorf("server has %s %s, want %s", fullname, repo.Visibility, want)
+		}
+	}
+}
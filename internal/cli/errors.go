@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+// Exit codes of ghpm, so that scripts can tell failures apart without parsing messages
+const (
+	ExitOK = 0
+	// anything not listed below
+	ExitError = 1
+	// a bulk switch switched some repositories, but others failed or were refused
+	ExitPartialFailure = 2
+	// a repository, organization or user was not found
+	ExitNotFound = 3
+	// github rejected the token, or the token is not allowed to do that
+	ExitForbidden = 4
+	// github kept rate limiting ghpm
+	ExitRateLimited = 5
+	// ghpm left repositories named explicitly as they are on purpose, see the skip policy. Nothing else failed
+	ExitProtectedRepository = 6
+	// a bulk switch had failures, and switched nothing
+	ExitTotalFailure = 7
+)
+
+// ExitCode maps an error returned by Execute to the exit code of ghpm
+func ExitCode(err error) int {
+
+	var protectedRepository ghpm.ErrProtectedRepository
+
+	var summaryError switchSummaryError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &summaryError) && len(summaryError.summary.Failed) == 0:
+		return ExitProtectedRepository
+	case errors.As(err, &summaryError) && summaryError.summary.Status() == ghpm.SummaryStatusTotalFailure:
+		return ExitTotalFailure
+	case errors.As(err, &summaryError):
+		return ExitPartialFailure
+	case errors.Is(err, ghpm.ErrRateLimited):
+		return ExitRateLimited
+	case errors.Is(err, ghpm.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, ghpm.ErrUnauthorized), errors.Is(err, ghpm.ErrForbidden):
+		return ExitForbidden
+	case errors.As(err, &protectedRepository):
+		return ExitProtectedRepository
+	}
+
+	return ExitError
+}
+
+// ErrorMessage is the message of err, followed by what to do about it when ghpm knows
+func ErrorMessage(err error) string {
+
+	message := err.Error()
+
+	var protectedRepository ghpm.ErrProtectedRepository
+
+	switch {
+	case errors.Is(err, ghpm.ErrRateLimited):
+		message += "\nwait a bit before running ghpm again, or lower --concurrency"
+	case errors.Is(err, ghpm.ErrNotFound):
+		message += "\ncheck the spelling, and that your token can see it: github answers not found to tokens that can't"
+	case errors.Is(err, ghpm.ErrUnauthorized):
+		message += "\nthe token is expired, revoked or mistyped. run: ghpm login"
+	case errors.Is(err, ghpm.ErrForbidden):
+		message += "\ncheck that your token has the repo scope, and that you are an admin of the repository"
+	case errors.As(err, &protectedRepository):
+		message += "\nsee ghpm switch_private --help to change which repositories are protected"
+	}
+
+	var apiError *ghpm.APIError
+
+	if errors.As(err, &apiError) && apiError.DocumentationURL != "" {
+		message += fmt.Sprintf("\nsee %s", apiError.DocumentationURL)
+	}
+
+	return message
+}
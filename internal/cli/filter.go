@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// recordFilter : one --filter field=value (or field!=value)
+type recordFilter struct {
+	field  string
+	value  string
+	negate bool
+}
+
+// addFilterFlag registers --filter on cmd
+func addFilterFlag(cmd *cobra.Command, filters *[]string) {
+	cmd.Flags().StringArrayVar(filters, "filter", nil, "keep only records where field=value (or field!=value). Repeatable, all must match. List fields like topics match if they contain the value")
+}
+
+func parseRecordFilter(filter string) (recordFilter, error) {
+
+	if field, value, found := strings.Cut(filter, "!="); found {
+		return recordFilter{field: field, value: value, negate: true}, nil
+	}
+
+	if field, value, found := strings.Cut(filter, "="); found {
+		return recordFilter{field: field, value: value}, nil
+	}
+
+	return recordFilter{}, fmt.Errorf("invalid filter %q, expected field=value or field!=value", filter)
+}
+
+// filterRecords keeps the records matching every filter
+func filterRecords[T any](records []T, fields []field[T], filters []string) ([]T, error) {
+
+	if len(filters) == 0 {
+		return records, nil
+	}
+
+	type compiledFilter struct {
+		recordFilter
+		field field[T]
+	}
+
+	compiledFilters := make([]compiledFilter, 0, len(filters))
+
+	for _, filter := range filters {
+
+		parsedFilter, err := parseRecordFilter(filter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		selectedFields, err := selectFields(fields, []string{parsedFilter.field})
+
+		if err != nil {
+			return nil, err
+		}
+
+		compiledFilters = append(compiledFilters, compiledFilter{recordFilter: parsedFilter, field: selectedFields[0]})
+	}
+
+	return slices.DeleteFunc(slices.Clone(records), func(record T) bool {
+
+		for _, filter := range compiledFilters {
+
+			if matchesFilter(filter.field.value(record), filter.value) == filter.negate {
+				return true
+			}
+		}
+
+		return false
+
+	}), nil
+}
+
+// matchesFilter compares the text form of value, case insensitively. Lists match if any element does
+func matchesFilter(value any, expected string) bool {
+
+	if values, ok := value.([]string); ok {
+		return slices.ContainsFunc(values, func(value string) bool { return strings.EqualFold(value, expected) })
+	}
+
+	return strings.EqualFold(formatValue(value), expected)
+}
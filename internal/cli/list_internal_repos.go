@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listAllInternalRepositoriesOutput  outputOptions
+	listAllInternalRepositoriesFilters []string
+)
+
+var listAllInternalRepositoriesCmd = &cobra.Command{
+	Use:   "list_internal",
+	Short: "List all the internal repositories you can see.",
+	Args:  cobra.NoArgs,
+	Long: heredoc.Docf(`
+		List all the internal repositories you can see.
+
+		Internal repositories are visible to every member of an enterprise.
+		Only organizations owned by an enterprise have them.
+	`, "`"),
+	Example: heredoc.Doc(`
+		# Starts interactive setup 
+		and lists the internal repositories you can see
+
+		All of them, page after page.
+		
+		$ ghpm list_internal
+
+		# pipe them into jq
+		$ ghpm list_internal --output json --fields full_name,stargazers_count | jq '.[].full_name'
+
+		# one name per line
+		$ ghpm list_internal --output names
+
+		# the internal repositories of an organization
+		$ ghpm list_internal --org my-org
+
+		# only the archived ones, with their license
+		$ ghpm list_internal --filter archived=true --fields full_name,license,pushed_at
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+		if err != nil {
+			return err
+		}
+
+		internalRepositories, err := ghPrivacyManager.ListAllInternalRepositories(cmd.Context())
+
+		if err != nil {
+			return err
+		}
+
+		internalRepositories, err = filterRecords(internalRepositories, repositoryFields, listAllInternalRepositoriesFilters)
+
+		if err != nil {
+			return err
+		}
+
+		return printRecords(cmd.OutOrStdout(), internalRepositories, repositoryFields, listAllInternalRepositoriesOutput)
+
+	},
+}
+
+func init() {
+	addOrganizationFlag(listAllInternalRepositoriesCmd)
+	addOutputFlags(listAllInternalRepositoriesCmd, &listAllInternalRepositoriesOutput, repositoryFields, defaultRepositoryFields)
+	addFilterFlag(listAllInternalRepositoriesCmd, &listAllInternalRepositoriesFilters)
+	rootCmd.AddCommand(listAllInternalRepositoriesCmd)
+}
@@ -1,13 +1,15 @@
 package cli
 
 import (
-	"net/http"
-
 	"github.com/MakeNowJust/heredoc"
-	"github.com/Neal-C/ghpm/internal/ghpm"
 	"github.com/spf13/cobra"
 )
 
+var (
+	listAllPrivateRepositoriesOutput  outputOptions
+	listAllPrivateRepositoriesFilters []string
+)
+
 var listAllPrivateRepositoriesCmd = &cobra.Command{
 	Use:   "list_private",
 	Short: "List all your private repositories.",
@@ -19,31 +21,50 @@ var listAllPrivateRepositoriesCmd = &cobra.Command{
 		# Starts interactive setup 
 		and lists your private repositories
 
-		Only the first 100 in alphabetical order.
+		All of them, page after page.
 		
 		$ ghpm list_private
+
+		# pipe them into jq
+		$ ghpm list_private --output json --fields full_name,stargazers_count | jq '.[].full_name'
+
+		# one name per line
+		$ ghpm list_private --output names
+
+		# the private repositories of an organization
+		$ ghpm list_private --org my-org
+
+		# only the archived ones, with their license
+		$ ghpm list_private --filter archived=true --fields full_name,license,pushed_at
 		`),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		token, err := ghpm.LoginToGithubWithDetecFlow()
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
 
 		if err != nil {
 			return err
 		}
 
-		ghPrivacyManager := ghpm.NewGithubPrivacyManager(token, http.DefaultClient)
+		privateRepositories, err := ghPrivacyManager.ListAllPrivateRepositories(cmd.Context())
+
+		if err != nil {
+			return err
+		}
 
-		err = ghPrivacyManager.ListAllPrivateRepositories(cmd.Context())
+		privateRepositories, err = filterRecords(privateRepositories, repositoryFields, listAllPrivateRepositoriesFilters)
 
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return printRecords(cmd.OutOrStdout(), privateRepositories, repositoryFields, listAllPrivateRepositoriesOutput)
 
 	},
 }
 
 func init() {
+	addOrganizationFlag(listAllPrivateRepositoriesCmd)
+	addOutputFlags(listAllPrivateRepositoriesCmd, &listAllPrivateRepositoriesOutput, repositoryFields, defaultRepositoryFields)
+	addFilterFlag(listAllPrivateRepositoriesCmd, &listAllPrivateRepositoriesFilters)
 	rootCmd.AddCommand(listAllPrivateRepositoriesCmd)
 }
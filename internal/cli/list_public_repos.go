@@ -1,13 +1,15 @@
 package cli
 
 import (
-	"net/http"
-
 	"github.com/MakeNowJust/heredoc"
-	"github.com/Neal-C/ghpm/internal/ghpm"
 	"github.com/spf13/cobra"
 )
 
+var (
+	listAllPublicRepositoriesOutput  outputOptions
+	listAllPublicRepositoriesFilters []string
+)
+
 var listAllPublicRepositoriesCmd = &cobra.Command{
 	Use:   "list_public",
 	Short: "List all your public repositories.",
@@ -19,31 +21,50 @@ var listAllPublicRepositoriesCmd = &cobra.Command{
 		# Starts interactive setup 
 		and lists your public repositories
 
-		Only the first 100 in alphabetical order.
+		All of them, page after page.
 		
 		$ ghpm list_public
+
+		# pipe them into jq
+		$ ghpm list_public --output json --fields full_name,stargazers_count | jq '.[].full_name'
+
+		# one name per line
+		$ ghpm list_public --output names
+
+		# the public repositories of an organization
+		$ ghpm list_public --org my-org
+
+		# only the archived ones, with their license
+		$ ghpm list_public --filter archived=true --fields full_name,license,pushed_at
 		`),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		token, err := ghpm.LoginToGithubWithDetecFlow()
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
 
 		if err != nil {
 			return err
 		}
 
-		ghPrivacyManager := ghpm.NewGithubPrivacyManager(token, http.DefaultClient)
+		publicRepositories, err := ghPrivacyManager.ListAllPublicRepositories(cmd.Context())
+
+		if err != nil {
+			return err
+		}
 
-		err = ghPrivacyManager.ListAllPublicRepositories(cmd.Context())
+		publicRepositories, err = filterRecords(publicRepositories, repositoryFields, listAllPublicRepositoriesFilters)
 
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return printRecords(cmd.OutOrStdout(), publicRepositories, repositoryFields, listAllPublicRepositoriesOutput)
 
 	},
 }
 
 func init() {
+	addOrganizationFlag(listAllPublicRepositoriesCmd)
+	addOutputFlags(listAllPublicRepositoriesCmd, &listAllPublicRepositoriesOutput, repositoryFields, defaultRepositoryFields)
+	addFilterFlag(listAllPublicRepositoriesCmd, &listAllPublicRepositoriesFilters)
 	rootCmd.AddCommand(listAllPublicRepositoriesCmd)
 }
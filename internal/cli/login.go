@@ -2,8 +2,10 @@ package cli
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/ghpm"
 	"github.com/spf13/cobra"
 )
 
@@ -15,28 +17,28 @@ var loginCmd = &cobra.Command{
 		Authenticate with a GitHub host.
 
 		The default hostname is %[1]sgithub.com%[1]s. This can be overridden using the %[1]s--hostname%[1]s
-		flag.
+		flag or the %[1]sGHPM_HOST%[1]s environment variable. Every command accepts %[1]s--hostname%[1]s,
+		tokens are stored per host.
 
-		The default authentication mode is a web-based browser flow. After completion, an
-		authentication token will be stored securely in the system credential store.
-		If a credential store is not found or there is an issue using it ghpm will fallback
-		to writing the token to a plain text file. See %[1]sgh auth status%[1]s for its
-		stored location.
+		On a GitHub Enterprise Server, the web-based flow needs an OAuth app registered on that server:
+		set its %[1]soauth_client_id%[1]s and %[1]soauth_client_secret%[1]s for the host in %[1]shosts.json%[1]s,
+		or use %[1]s--with-token%[1]s.
 
-		Alternatively, use %[1]s--with-token%[1]s to pass in a token on standard input.
-		The minimum required scopes for the token are: %[1]srepo%[1]s, %[1]sread:org%[1]s, and %[1]sgist%[1]s.
+		The default authentication mode is a web-based browser flow. After completion, the
+		authentication token is written to a file only readable by you, in your config directory.
+		Every other command reuses it. See %[1]sghpm auth status%[1]s for its stored location
+		and %[1]sghpm logout%[1]s to remove it.
 
-		Alternatively, ghpm will use the authentication token found in environment variables.
-		This method is most suitable for "headless" use of gh such as in automation. See
-		%[1]sgh help environment%[1]s for more info.
+		Alternatively, use %[1]s--with-token%[1]s to pass in a token on standard input.
+		The minimum required scope for the token is: %[1]srepo%[1]s.
 
-		The git protocol to use for git operations on this host can be set with %[1]s--git-protocol%[1]s,
-		or during the interactive prompting. Although login is for a single account on a host, setting
-		the git protocol will take effect for all users on the host.
+		Alternatively, ghpm will use the authentication token found in the %[1]sGHPM_TOKEN%[1]s,
+		%[1]sGH_TOKEN%[1]s or %[1]sGITHUB_TOKEN%[1]s environment variables, without storing it.
+		This method is most suitable for "headless" use of ghpm such as in automation.
+		Every command also accepts %[1]s--token%[1]s and %[1]s--with-token%[1]s.
 
-		Specifying %[1]sssh%[1]s for the git protocol will detect existing SSH keys to upload,
-		prompting to create and upload a new key if one is not found. This can be skipped with
-		%[1]s--skip-ssh-key%[1]s flag.
+		With %[1]s--profile%[1]s, the token is stored in that profile along with the host and who the token
+		belongs to, and the profile is created if needed. See %[1]sghpm auth switch%[1]s.
 	`, "`"),
 	Example: heredoc.Doc(`
 		# Start interactive setup
@@ -44,10 +46,69 @@ var loginCmd = &cobra.Command{
 
 		# Authenticate against github.com by reading the token from a file
 		$ ghpm login --with-token < mytoken.txt
+
+		# Authenticate against a GitHub Enterprise Server
+		$ ghpm login --hostname github.example.com --with-token < mytoken.txt
+
+		# A second account, in a profile of its own
+		$ ghpm login --profile work --hostname github.example.com
+
+		# No login needed in CI
+		$ GITHUB_TOKEN=<token> ghpm list_private
 		`),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		fmt.Println("this command does nothing for now. Placeholder in case I want to implement persist auth across multiple commands")
+		hostname := currentHostname()
+
+		token, _, err := explicitGithubAuthToken(cmd)
+
+		if err != nil {
+			return err
+		}
+
+		if token == "" {
+
+			token, err = loginWithDeviceFlow(hostname)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		tokenPath, err := storedTokenPath()
+
+		if err != nil {
+			return err
+		}
+
+		if activeProfileName == "" {
+
+			if err := storeToken(hostname, token); err != nil {
+				return err
+			}
+
+			fmt.Printf("logged in to %s. Token stored in %s \n", hostname, tokenPath)
+
+			return nil
+		}
+
+		// a profile remembers who its token belongs to, and only keeps tokens github accepts
+		ghPrivacyManager, err := ghpm.NewGithubPrivacyManager(cmd.Context(), apiBaseURL(hostname), ghpm.StaticToken(token), http.DefaultClient)
+
+		if err != nil {
+			return err
+		}
+
+		if err := storeToken(hostname, token); err != nil {
+			return err
+		}
+
+		if err := rememberProfileUsername(ghPrivacyManager.Username()); err != nil {
+			return err
+		}
+
+		fmt.Printf("logged in to %s as %s, profile %s. Token stored in %s \n", hostname, ghPrivacyManager.Username(), activeProfileName, tokenPath)
+
 		return nil
 	},
 }
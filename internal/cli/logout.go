@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the token stored by ghpm login.",
+	Args:  cobra.NoArgs,
+	Long: heredoc.Docf(`
+		Remove the token stored by %[1]sghpm login%[1]s.
+
+		The token is only forgotten locally. To revoke it, go to
+		https://github.com/settings/applications (or the same page on your GitHub Enterprise Server)
+	`, "`"),
+	Example: heredoc.Doc(`
+		$ ghpm logout
+
+		$ ghpm logout --hostname github.example.com
+
+		$ ghpm logout --profile work
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		hostname := currentHostname()
+
+		if err := deleteStoredToken(hostname); err != nil {
+			return err
+		}
+
+		if activeProfileName != "" {
+
+			fmt.Printf("logged out of the profile %s. Its token was removed \n", activeProfileName)
+
+			return nil
+		}
+
+		fmt.Printf("logged out of %s. The stored token was removed \n", hostname)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+}
@@ -0,0 +1,336 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var outputFormats = []string{"table", "json", "yaml", "csv", "names"}
+
+// outputOptions : the --output and --fields flags of a command
+type outputOptions struct {
+	format string
+	fields []string
+}
+
+// field : one selectable column of the output
+type field[T any] struct {
+	name  string
+	value func(T) any
+}
+
+// repositoryFields : every field of ghpm.GithubRepository that can be selected with --fields.
+// Names follow the github API
+var repositoryFields = []field[ghpm.GithubRepository]{
+	{"full_name", func(repo ghpm.GithubRepository) any { return repo.Fullname }},
+	{"name", func(repo ghpm.GithubRepository) any { return repo.Name }},
+	{"private", func(repo ghpm.GithubRepository) any { return repo.Private }},
+	{"visibility", func(repo ghpm.GithubRepository) any { return repo.Visibility }},
+	{"stargazers_count", func(repo ghpm.GithubRepository) any { return repo.Stars }},
+	{"fork", func(repo ghpm.GithubRepository) any { return repo.IsFork }},
+	{"archived", func(repo ghpm.GithubRepository) any { return repo.Archived }},
+	{"is_template", func(repo ghpm.GithubRepository) any { return repo.IsTemplate }},
+	{"has_pages", func(repo ghpm.GithubRepository) any { return repo.HasPages }},
+	{"forks_count", func(repo ghpm.GithubRepository) any { return repo.Forks }},
+	{"watchers_count", func(repo ghpm.GithubRepository) any { return repo.Watchers }},
+	{"pushed_at", func(repo ghpm.GithubRepository) any { return repo.PushedAt }},
+	{"created_at", func(repo ghpm.GithubRepository) any { return repo.CreatedAt }},
+	{"updated_at", func(repo ghpm.GithubRepository) any { return repo.UpdatedAt }},
+	{"owner", func(repo ghpm.GithubRepository) any { return repo.Owner.Login }},
+	{"owner_type", func(repo ghpm.GithubRepository) any { return repo.Owner.Type }},
+	{"topics", func(repo ghpm.GithubRepository) any { return repo.Topics }},
+	{"language", func(repo ghpm.GithubRepository) any { return repo.Language }},
+	{"license", func(repo ghpm.GithubRepository) any {
+		if repo.License == nil {
+			return ""
+		}
+		return repo.License.SPDXID
+	}},
+	{"default_branch", func(repo ghpm.GithubRepository) any { return repo.DefaultBranch }},
+	{"size", func(repo ghpm.GithubRepository) any { return repo.Size }},
+	{"admin", func(repo ghpm.GithubRepository) any { return repo.Permissions.Admin }},
+}
+
+var defaultRepositoryFields = []string{"full_name", "visibility", "stargazers_count", "fork"}
+
+// switchResultFields : the repository fields, plus what happened to the repository
+var switchResultFields = append(
+	[]field[ghpm.SwitchResult]{
+		{"outcome", func(result ghpm.SwitchResult) any { return result.Outcome }},
+		{"reason", func(result ghpm.SwitchResult) any { return result.Reason }},
+	},
+	repositoryFieldsOf(func(result ghpm.SwitchResult) ghpm.GithubRepository { return result.Repository })...,
+)
+
+var defaultSwitchResultFields = []string{"full_name", "outcome", "reason"}
+
+// repositoryFieldsOf lifts repositoryFields to any record that holds a repository
+func repositoryFieldsOf[T any](repositoryOf func(T) ghpm.GithubRepository) []field[T] {
+
+	fields := make([]field[T], 0, len(repositoryFields))
+
+	for _, repositoryField := range repositoryFields {
+		fields = append(fields, field[T]{
+			name:  repositoryField.name,
+			value: func(record T) any { return repositoryField.value(repositoryOf(record)) },
+		})
+	}
+
+	return fields
+}
+
+func fieldNames[T any](fields []field[T]) []string {
+
+	names := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+
+	return names
+}
+
+// addOutputFlags registers --output and --fields on cmd
+func addOutputFlags[T any](cmd *cobra.Command, options *outputOptions, fields []field[T], defaultFields []string) {
+
+	cmd.Flags().StringVarP(&options.format, "output", "o", "table", fmt.Sprintf("output format: %s", strings.Join(outputFormats, "|")))
+
+	cmd.Flags().StringSliceVar(&options.fields, "fields", defaultFields, fmt.Sprintf("comma separated fields to output, among: %s", strings.Join(fieldNames(fields), ",")))
+}
+
+// addAlternateFields documents on --fields of cmd the fields of the other records it prints when flagName is given,
+// like the plan of --dry-run. See alternateOutput
+func addAlternateFields[T any](cmd *cobra.Command, flagName string, fields []field[T]) {
+
+	fieldsFlag := cmd.Flags().Lookup("fields")
+
+	fieldsFlag.Usage += fmt.Sprintf(". With %s, among: %s, all by default", flagName, strings.Join(fieldNames(fields), ","))
+}
+
+// alternateOutput returns options for records of fields instead of the ones --fields was registered for:
+// --fields when given, checked against fields, every field of fields otherwise
+func alternateOutput[T any](cmd *cobra.Command, options outputOptions, fields []field[T]) outputOptions {
+
+	if !cmd.Flags().Changed("fields") {
+		options.fields = fieldNames(fields)
+	}
+
+	return options
+}
+
+// outputColumn and outputRow keep the order of --fields in json and yaml, which maps would lose
+type outputColumn struct {
+	name  string
+	value any
+}
+
+type outputRow []outputColumn
+
+func (self outputRow) MarshalJSON() ([]byte, error) {
+
+	var buffer bytes.Buffer
+
+	buffer.WriteByte('{')
+
+	for index, column := range self {
+
+		if index > 0 {
+			buffer.WriteByte(',')
+		}
+
+		name, err := json.Marshal(column.name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(column.value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+func (self outputRow) MarshalYAML() (any, error) {
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, column := range self {
+
+		value := &yaml.Node{}
+
+		if err := value.Encode(column.value); err != nil {
+			return nil, err
+		}
+
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: column.name}, value)
+	}
+
+	return mapping, nil
+}
+
+// printRecords writes records to w in the format and with the fields selected by options
+func printRecords[T any](w io.Writer, records []T, fields []field[T], options outputOptions) error {
+
+	selectedFields, err := selectFields(fields, options.fields)
+
+	if err != nil {
+		return err
+	}
+
+	rows := make([]outputRow, 0, len(records))
+
+	for _, record := range records {
+
+		row := make(outputRow, 0, len(selectedFields))
+
+		for _, selectedField := range selectedFields {
+			row = append(row, outputColumn{name: selectedField.name, value: selectedField.value(record)})
+		}
+
+		rows = append(rows, row)
+	}
+
+	switch options.format {
+	case "json":
+
+		encoder := json.NewEncoder(w)
+
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(rows)
+
+	case "yaml":
+
+		encoder := yaml.NewEncoder(w)
+
+		encoder.SetIndent(2)
+
+		if err := encoder.Encode(rows); err != nil {
+			return err
+		}
+
+		return encoder.Close()
+
+	case "csv":
+
+		csvWriter := csv.NewWriter(w)
+
+		if err := csvWriter.Write(fieldNames(selectedFields)); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := csvWriter.Write(formatRow(row)); err != nil {
+				return err
+			}
+		}
+
+		csvWriter.Flush()
+
+		return csvWriter.Error()
+
+	case "table":
+
+		tableWriter := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+		fmt.Fprintln(tableWriter, strings.ToUpper(strings.Join(fieldNames(selectedFields), "\t")))
+
+		for _, row := range rows {
+			fmt.Fprintln(tableWriter, strings.Join(formatRow(row), "\t"))
+		}
+
+		return tableWriter.Flush()
+
+	case "names":
+
+		nameField, err := selectFields(fields, []string{"full_name"})
+
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			fmt.Fprintln(w, nameField[0].value(record))
+		}
+
+		return nil
+
+	default:
+
+		return fmt.Errorf("unknown output format %q, expected one of: %s", options.format, strings.Join(outputFormats, ", "))
+	}
+}
+
+// selectFields returns the fields named by names, in the order of names
+func selectFields[T any](fields []field[T], names []string) ([]field[T], error) {
+
+	selectedFields := make([]field[T], 0, len(names))
+
+	for _, name := range names {
+
+		index := slices.IndexFunc(fields, func(field field[T]) bool { return field.name == name })
+
+		if index == -1 {
+			return nil, fmt.Errorf("unknown field %q, expected some of: %s", name, strings.Join(fieldNames(fields), ", "))
+		}
+
+		selectedFields = append(selectedFields, fields[index])
+	}
+
+	return selectedFields, nil
+}
+
+// formatRow turns a row into text, for csv and table
+func formatRow(row outputRow) []string {
+
+	values := make([]string, 0, len(row))
+
+	for _, column := range row {
+		values = append(values, formatValue(column.value))
+	}
+
+	return values
+}
+
+// formatValue turns a field value into text, for csv, table and --filter
+func formatValue(value any) string {
+
+	switch value := value.(type) {
+	case time.Time:
+
+		if value.IsZero() {
+			return ""
+		}
+
+		return value.Format(time.RFC3339)
+
+	case []string:
+
+		return strings.Join(value, ",")
+
+	default:
+
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planOutputFile string
+	planPolicyFile string
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Save what thanos_snap would do in a plan file, to review and apply later.",
+	Args:  cobra.NoArgs,
+	Long: heredoc.Docf(`
+		Save what %[1]sthanos_snap%[1]s would do in a plan file, to review and apply later with %[1]sghpm apply%[1]s.
+
+		The plan lists every public repository with its current visibility, its target visibility
+		and a fingerprint of its state (its %[1]supdated_at%[1]s). Skipped repositories keep their
+		visibility and come with the reason why.
+
+		With %[1]s--policy%[1]s, the plan is what %[1]sghpm reconcile%[1]s would do with that policy file instead.
+
+		Nothing is changed on github.
+	`, "`"),
+	Example: heredoc.Doc(`
+		$ ghpm plan -o plan.json
+
+		# review plan.json, then
+		$ ghpm apply plan.json
+
+		$ ghpm plan --policy ghpm.yaml -o plan.json
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+		if err != nil {
+			return err
+		}
+
+		var plan ghpm.Plan
+
+		if planPolicyFile != "" {
+
+			policy, err := readVisibilityPolicy(planPolicyFile)
+
+			if err != nil {
+				return err
+			}
+
+			plan, err = ghPrivacyManager.NewReconcilePlan(cmd.Context(), policy)
+
+			if err != nil {
+				return err
+			}
+
+		} else {
+
+			plan, err = ghPrivacyManager.NewPlanAllRepositoriesToPrivate(cmd.Context())
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if planOutputFile == "" || planOutputFile == "-" {
+			return ghpm.WritePlan(cmd.OutOrStdout(), plan)
+		}
+
+		planFile, err := os.Create(planOutputFile)
+
+		if err != nil {
+			return err
+		}
+
+		if err := ghpm.WritePlan(planFile, plan); err != nil {
+			planFile.Close()
+			return err
+		}
+
+		if err := planFile.Close(); err != nil {
+			return err
+		}
+
+		changes := 0
+
+		for _, entry := range plan.Entries {
+			if entry.Changes() {
+				changes++
+			}
+		}
+
+		fmt.Printf("plan written to %s: %d repositories to switch, %d skipped \n", planOutputFile, changes, len(plan.Entries)-changes)
+		fmt.Printf("review it, then run: ghpm apply %s \n", planOutputFile)
+
+		return nil
+	},
+}
+
+func init() {
+	addOrganizationFlag(planCmd)
+	addSkipPolicyFlags(planCmd)
+	planCmd.Flags().StringVarP(&planOutputFile, "out", "o", "", "file to write the plan to, standard output when empty")
+	planCmd.Flags().StringVar(&planPolicyFile, "policy", "", "plan what ghpm reconcile would do with this policy file, instead of thanos_snap")
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var profileFlag string
+
+// the profile of the running command, resolved before it runs. activeProfileName is empty without profile
+var (
+	activeProfileName string
+	activeProfile     config.Profile
+)
+
+// resolveProfile loads the profile of --profile, GHPM_PROFILE or profiles.json into activeProfile.
+// A profile that does not exist is an error, acting on another account by default would be worse,
+// except for the commands that create profiles or switch between them
+func resolveProfile(cmd *cobra.Command) error {
+
+	profiles, err := config.LoadProfiles()
+
+	if err != nil {
+		return err
+	}
+
+	activeProfileName = config.ResolveProfileName(profileFlag, profiles)
+	activeProfile = config.Profile{}
+
+	if activeProfileName == "" {
+		return nil
+	}
+
+	profile, err := profiles.Profile(activeProfileName)
+
+	if err != nil {
+
+		if cmd == loginCmd || cmd == authSwitchCmd {
+			return nil
+		}
+
+		return fmt.Errorf("%w. Create it with: ghpm login --profile %s", err, activeProfileName)
+	}
+
+	activeProfile = profile
+
+	return nil
+}
+
+// loadStoredToken returns the token of the active profile, or the one stored by ghpm login for the host without profile.
+// config.ErrNoStoredToken when there is none
+func loadStoredToken(hostname string) (string, error) {
+
+	if activeProfileName == "" {
+		return config.LoadToken(hostname)
+	}
+
+	if err := checkProfileHost(hostname); err != nil {
+		return "", err
+	}
+
+	if activeProfile.OauthToken == "" {
+		return "", config.ErrNoStoredToken
+	}
+
+	return activeProfile.OauthToken, nil
+}
+
+// checkProfileHost refuses hostname when it is not the host of the active profile, given by --hostname or GHPM_HOST:
+// the token of the profile belongs to its host, and is never sent to another one
+func checkProfileHost(hostname string) error {
+
+	profileHostname := config.ResolveHostname(activeProfile.Host)
+
+	if hostname == profileHostname {
+		return nil
+	}
+
+	return fmt.Errorf("the profile %s is for %s, not %s. Use another profile, or log it in to %s with: ghpm login --profile %s --hostname %s",
+		activeProfileName, profileHostname, hostname, hostname, activeProfileName, hostname)
+}
+
+// storeToken stores token for the next commands, in the active profile along with the host, or for the host without profile
+func storeToken(hostname string, token string) error {
+
+	if activeProfileName == "" {
+		return config.SaveToken(hostname, token)
+	}
+
+	update := func(profile *config.Profile) {
+		profile.Host = hostname
+		profile.OauthToken = token
+		// a new token may belong to another account, see rememberProfileUsername
+		profile.Username = ""
+	}
+
+	update(&activeProfile)
+
+	return config.UpdateProfile(activeProfileName, update)
+}
+
+// rememberProfileUsername records who the token of the active profile belongs to, once github told
+func rememberProfileUsername(username string) error {
+
+	if activeProfileName == "" || activeProfile.Username == username {
+		return nil
+	}
+
+	activeProfile.Username = username
+
+	return config.UpdateProfile(activeProfileName, func(profile *config.Profile) {
+		profile.Username = username
+	})
+}
+
+// deleteStoredToken removes the token of the active profile, or the one of the host without profile
+func deleteStoredToken(hostname string) error {
+
+	if activeProfileName == "" {
+		return config.DeleteToken(hostname)
+	}
+
+	if err := checkProfileHost(hostname); err != nil {
+		return err
+	}
+
+	return config.UpdateProfile(activeProfileName, func(profile *config.Profile) {
+		profile.OauthToken = ""
+		profile.Username = ""
+	})
+}
+
+// storedTokenPath returns the file the stored token is read from
+func storedTokenPath() (string, error) {
+
+	if activeProfileName == "" {
+		return config.HostsPath()
+	}
+
+	return config.ProfilesPath()
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "named profile to use: its host, token, organization and skip policy. Defaults to GHPM_PROFILE, then the one of ghpm auth switch")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return resolveProfile(cmd)
+	}
+}
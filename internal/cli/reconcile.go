@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reconcileOutput     outputOptions
+	reconcilePolicyFile string
+	reconcileDryRun     bool
+	reconcileSummary    string
+)
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Converge the visibility of your repositories to the one described in ghpm.yaml.",
+	Args:  cobra.NoArgs,
+	Long: heredoc.Docf(`
+		Converge the visibility of your repositories to the one described in a policy file, %[1]sghpm.yaml%[1]s by default.
+
+		The policy is a list of rules evaluated in order: the first rule matching a repository
+		decides if it should be %[1]sprivate%[1]s, %[1]spublic%[1]s, %[1]sinternal%[1]s (enterprise organizations only)
+		or left alone (%[1]signore%[1]s).
+		%[1]sdefault%[1]s applies when no rule matches, and is %[1]signore%[1]s when not set.
+
+		A rule matches when every condition of its %[1]smatch%[1]s holds:
+		  name            glob on the repository name, or on owner/name when it contains a /
+		  topic           the repository has this topic
+		  language        primary language
+		  archived        true or false
+		  fork            true or false
+		  min_stars       at least this many stars
+		  max_stars       at most this many stars
+		  not_pushed_for  last push is older than this: 90d, 2w, 1y, 720h
+
+		Repositories the policy wants private still go through the skip policy
+		(%[1]s--max-stars%[1]s, %[1]s--include-forks%[1]s, %[1]s--allow-readme-repo%[1]s).
+
+		Keep the policy file in a repository and review its changes like any other code.
+		%[1]sghpm plan --policy ghpm.yaml -o plan.json%[1]s saves the changes for %[1]sghpm apply%[1]s.
+	`, "`"),
+	Example: heredoc.Doc(`
+		$ cat ghpm.yaml
+		rules:
+		  - name: showcase stays public
+		    match:
+		      topic: showcase
+		    visibility: public
+		  - name: hide experiments
+		    match:
+		      name: "*-experiment"
+		    visibility: private
+		  - name: hide what's abandoned
+		    match:
+		      fork: false
+		      not_pushed_for: 2y
+		    visibility: private
+		default: ignore
+
+		# see what would change
+		$ ghpm reconcile --dry-run
+
+		$ ghpm reconcile -f ghpm.yaml
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		policy, err := readVisibilityPolicy(reconcilePolicyFile)
+
+		if err != nil {
+			return err
+		}
+
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+		if err != nil {
+			return err
+		}
+
+		plan, err := ghPrivacyManager.NewReconcilePlan(cmd.Context(), policy)
+
+		if err != nil {
+			return err
+		}
+
+		if reconcileDryRun {
+			return printRecords(cmd.OutOrStdout(), plan.Entries, planEntryFields, alternateOutput(cmd, reconcileOutput, planEntryFields))
+		}
+
+		results, err := ghPrivacyManager.ApplyPlan(cmd.Context(), plan)
+
+		if err != nil {
+			return err
+		}
+
+		return reportSwitch(cmd, results, reconcileOutput, reconcileSummary, nil)
+	},
+}
+
+// planEntryFields : the columns of a plan, for ghpm reconcile --dry-run
+var planEntryFields = []field[ghpm.PlanEntry]{
+	{"full_name", func(entry ghpm.PlanEntry) any { return entry.Repository }},
+	{"current_visibility", func(entry ghpm.PlanEntry) any { return entry.CurrentVisibility }},
+	{"target_visibility", func(entry ghpm.PlanEntry) any { return entry.TargetVisibility }},
+	{"reason", func(entry ghpm.PlanEntry) any { return entry.Reason }},
+}
+
+func readVisibilityPolicy(policyFile string) (ghpm.VisibilityPolicy, error) {
+
+	policyReader, err := os.Open(policyFile)
+
+	if err != nil {
+		return ghpm.VisibilityPolicy{}, err
+	}
+
+	defer policyReader.Close()
+
+	policy, err := ghpm.ParseVisibilityPolicy(policyReader)
+
+	if err != nil {
+		return ghpm.VisibilityPolicy{}, fmt.Errorf("%s: %w", policyFile, err)
+	}
+
+	return policy, nil
+}
+
+func init() {
+	addOrganizationFlag(reconcileCmd)
+	addSkipPolicyFlags(reconcileCmd)
+	reconcileCmd.Flags().StringVarP(&reconcilePolicyFile, "file", "f", "ghpm.yaml", "policy file describing the desired visibility")
+	reconcileCmd.Flags().BoolVar(&reconcileDryRun, "dry-run", false, "print the changes the policy asks for, without changing anything")
+	addOutputFlags(reconcileCmd, &reconcileOutput, switchResultFields, defaultSwitchResultFields)
+	addAlternateFields(reconcileCmd, "--dry-run", planEntryFields)
+	addSummaryFlag(reconcileCmd, &reconcileSummary)
+	rootCmd.AddCommand(reconcileCmd)
+}
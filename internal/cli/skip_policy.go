@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxStarsFlag        uint
+	includeForksFlag    bool
+	allowReadmeRepoFlag bool
+)
+
+// skipPolicy returns ghpm.DefaultSkipPolicy, overridden by config.json, then by the profile, then by the flags given
+func skipPolicy(cmd *cobra.Command) (ghpm.SkipPolicy, error) {
+
+	policy := ghpm.DefaultSkipPolicy()
+
+	settings, err := config.LoadSettings()
+
+	if err != nil {
+		return ghpm.SkipPolicy{}, err
+	}
+
+	applySkipPolicySettings(&policy, settings.SkipPolicy)
+
+	applySkipPolicySettings(&policy, activeProfile.SkipPolicy)
+
+	if cmd.Flags().Changed("max-stars") {
+		policy.MaxStars = maxStarsFlag
+	}
+
+	if cmd.Flags().Changed("include-forks") {
+		policy.IncludeForks = includeForksFlag
+	}
+
+	if cmd.Flags().Changed("allow-readme-repo") {
+		policy.AllowReadmeRepository = allowReadmeRepoFlag
+	}
+
+	return policy, nil
+}
+
+// applySkipPolicySettings overrides policy with the values set in settings
+func applySkipPolicySettings(policy *ghpm.SkipPolicy, settings config.SkipPolicySettings) {
+
+	if settings.MaxStars != nil {
+		policy.MaxStars = *settings.MaxStars
+	}
+
+	if settings.IncludeForks != nil {
+		policy.IncludeForks = *settings.IncludeForks
+	}
+
+	if settings.AllowReadmeRepository != nil {
+		policy.AllowReadmeRepository = *settings.AllowReadmeRepository
+	}
+}
+
+// addSkipPolicyFlags registers --max-stars, --include-forks and --allow-readme-repo on the commands that switch repositories
+func addSkipPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().UintVar(&maxStarsFlag, "max-stars", 0, "repositories with more stars than this are never switched to private")
+	cmd.Flags().BoolVar(&includeForksFlag, "include-forks", false, "allow switching forks to private")
+	cmd.Flags().BoolVar(&allowReadmeRepoFlag, "allow-readme-repo", false, "allow switching your profile README repository (username/username) to private")
+}
@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+// switchSummaryError : some repositories of a bulk switch failed, or were refused. See ExitCode
+type switchSummaryError struct {
+	summary ghpm.SwitchSummary
+}
+
+func (self switchSummaryError) Error() string {
+
+	switch {
+	case len(self.summary.Refused) == 0:
+		return fmt.Sprintf("%d of %d repositories failed to switch", len(self.summary.Failed), self.summary.Total())
+	case len(self.summary.Failed) == 0:
+		return fmt.Sprintf("%d of %d repositories were left as they are on purpose", len(self.summary.Refused), self.summary.Total())
+	default:
+		return fmt.Sprintf("%d of %d repositories failed to switch, and %d were left as they are on purpose", len(self.summary.Failed), self.summary.Total(), len(self.summary.Refused))
+	}
+}
+
+// Unwrap gives the errors of the refused and failed repositories, for ErrorMessage to tell what to do about them
+func (self switchSummaryError) Unwrap() []error {
+
+	errs := make([]error, 0, len(self.summary.Refused)+len(self.summary.Failed))
+
+	for _, result := range slices.Concat(self.summary.Refused, self.summary.Failed) {
+		errs = append(errs, result.Err)
+	}
+
+	return errs
+}
+
+// summaryFile : what --summary-json writes.
+// Repositories named explicitly, as arguments or in --from-file, that ghpm left as they are on purpose (skip policy, profile README)
+// are listed in refused, and count as failures: the run did not do what was asked. Its status is then partial_failure or total_failure,
+// and ghpm exits with ExitProtectedRepository when nothing else failed.
+// Repositories left out of a bulk selection (--match, --regex, thanos_snap, plan, reconcile) are listed in skipped, and are not failures
+type summaryFile struct {
+	RunID string `json:"run_id"`
+
+	Status ghpm.SummaryStatus `json:"status"`
+
+	Switched []summaryEntry `json:"switched"`
+
+	Skipped []summaryEntry `json:"skipped"`
+
+	Failed []summaryEntry `json:"failed"`
+
+	Refused []summaryEntry `json:"refused"`
+}
+
+type summaryEntry struct {
+	Repository string `json:"full_name"`
+
+	// after the switch
+	Visibility string `json:"visibility"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+func summaryEntriesOf(results []ghpm.SwitchResult) []summaryEntry {
+
+	entries := make([]summaryEntry, 0, len(results))
+
+	for _, result := range results {
+		entries = append(entries, summaryEntry{Repository: result.Repository.Fullname, Visibility: result.Repository.Visibility, Reason: result.Reason})
+	}
+
+	return entries
+}
+
+// addSummaryFlag registers --summary-json on the commands that switch repositories
+func addSummaryFlag(cmd *cobra.Command, summaryPath *string) {
+	cmd.Flags().StringVar(summaryPath, "summary-json", "", "also write the switched, skipped, failed and refused repositories to this json file, for CI")
+}
+
+// reportSwitch prints results, writes the summary file when asked, and fails when any repository did. See summarizeSwitch for named
+func reportSwitch(cmd *cobra.Command, results []ghpm.SwitchResult, options outputOptions, summaryPath string, named func(ghpm.SwitchResult) bool) error {
+
+	if err := printRecords(cmd.OutOrStdout(), results, switchResultFields, options); err != nil {
+		return err
+	}
+
+	return summarizeSwitch(results, summaryPath, named)
+}
+
+// summarizeSwitch writes the summary file when asked, and fails when any repository did.
+// named tells the repositories that were asked for by name, that ghpm refuses to leave as is silently. nil when none was, see summaryFile
+func summarizeSwitch(results []ghpm.SwitchResult, summaryPath string, named func(ghpm.SwitchResult) bool) error {
+
+	summary := ghpm.NewSwitchSummary(results)
+
+	if named != nil {
+		summary = summary.RefuseNamed(named)
+	}
+
+	if summaryPath != "" {
+
+		if err := writeSummaryFile(summaryPath, summary); err != nil {
+			return err
+		}
+	}
+
+	if summary.Status() != ghpm.SummaryStatusSuccess {
+		return switchSummaryError{summary: summary}
+	}
+
+	return nil
+}
+
+func writeSummaryFile(path string, summary ghpm.SwitchSummary) error {
+
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(summaryFile{
+		RunID:    runID,
+		Status:   summary.Status(),
+		Switched: summaryEntriesOf(summary.Switched),
+		Skipped:  summaryEntriesOf(summary.Skipped),
+		Failed:   summaryEntriesOf(summary.Failed),
+		Refused:  summaryEntriesOf(summary.Refused),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buffer.Bytes(), 0644)
+}
+
+// reportPreflight lists on stderr, before anything changes, the repositories the token can't change
+func reportPreflight(cmd *cobra.Command, refused []ghpm.SwitchResult) {
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "the token can't change %d repositories, they are left as they are:\n", len(refused))
+
+	printRecords(cmd.ErrOrStderr(), refused, switchResultFields, outputOptions{format: "table", fields: []string{"full_name", "reason"}})
+
+	fmt.Fprintln(cmd.ErrOrStderr())
+}
+
+// allNamed : every repository of the run was asked for by name
+func allNamed(ghpm.SwitchResult) bool {
+	return true
+}
@@ -1,13 +1,16 @@
 package cli
 
 import (
-	"net/http"
-
 	"github.com/MakeNowJust/heredoc"
-	"github.com/Neal-C/ghpm/internal/ghpm"
 	"github.com/spf13/cobra"
 )
 
+var (
+	switchAllToPrivateOutput  outputOptions
+	switchAllToPrivateDryRun  bool
+	switchAllToPrivateSummary string
+)
+
 var switchAllToPrivateCmd = &cobra.Command{
 	Use:   "thanos_snap",
 	Short: "Switch all your public repositories to private.",
@@ -15,37 +18,69 @@ var switchAllToPrivateCmd = &cobra.Command{
 	Long: heredoc.Docf(`
 		Switch all your public repositories to private.
 
-		By default, starred repositories with 1 stars are not turned private.
+		By default, starred repositories, forks and your profile README repository are not turned private.
+		Change that with %[1]s--max-stars%[1]s, %[1]s--include-forks%[1]s and %[1]s--allow-readme-repo%[1]s,
+		or with %[1]sskip_policy%[1]s in %[1]sconfig.json%[1]s, in your config directory.
 
-		Starts interactive setup and does a HTTP request against all your public repositories to turn them private
+		Starts interactive setup and does a HTTP request against all your public repositories to turn them private,
+		%[1]s--concurrency%[1]s at a time. When github rate limits ghpm, it pauses until github allows it again.
+
+		With %[1]s--dry-run%[1]s, nothing is changed: ghpm prints which repositories would be switched
+		(outcome %[1]splanned%[1]s) and which would be skipped, with the reason why.
 	`, "`"),
 	Example: heredoc.Doc(`
 		# Starts interactive setup 
 		and request all your public repositories to turn private
 		
 		$ ghpm thanos_snap
+
+		# the public repositories of an organization you administer
+		$ ghpm thanos_snap --org my-org --dry-run
+
+		# see what would happen, without changing anything
+		$ ghpm thanos_snap --dry-run
+
+		# keep a record of what happened
+		$ ghpm thanos_snap --output csv > thanos_snap.csv
+
+		# in CI: exits 2 when some repositories failed, 7 when all did
+		$ ghpm thanos_snap --summary-json summary.json
 		`),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		token, err := ghpm.LoginToGithubWithDetecFlow()
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
 
 		if err != nil {
 			return err
 		}
 
-		ghPrivacyManager := ghpm.NewGithubPrivacyManager(token, http.DefaultClient)
+		if switchAllToPrivateDryRun {
+
+			plan, err := ghPrivacyManager.PlanAllRepositoriesToPrivate(cmd.Context())
+
+			if err != nil {
+				return err
+			}
+
+			return printRecords(cmd.OutOrStdout(), plan, switchResultFields, switchAllToPrivateOutput)
+		}
 
-		err = ghPrivacyManager.SwitchAllRepositoriesToPrivate(cmd.Context())
+		results, err := ghPrivacyManager.SwitchAllRepositoriesToPrivate(cmd.Context())
 
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return reportSwitch(cmd, results, switchAllToPrivateOutput, switchAllToPrivateSummary, nil)
 
 	},
 }
 
 func init() {
+	addOrganizationFlag(switchAllToPrivateCmd)
+	addSkipPolicyFlags(switchAllToPrivateCmd)
+	switchAllToPrivateCmd.Flags().BoolVar(&switchAllToPrivateDryRun, "dry-run", false, "print which repositories would be switched or skipped, without changing anything")
+	addOutputFlags(switchAllToPrivateCmd, &switchAllToPrivateOutput, switchResultFields, defaultSwitchResultFields)
+	addSummaryFlag(switchAllToPrivateCmd, &switchAllToPrivateSummary)
 	rootCmd.AddCommand(switchAllToPrivateCmd)
 }
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+// switchOptions : the flags shared by switch_private, switch_public and switch_internal
+type switchOptions struct {
+	output outputOptions
+
+	globs []string
+
+	regularExpressions []string
+
+	// don't ask for confirmation
+	yes bool
+
+	fromFile string
+
+	inputFormat string
+
+	// --summary-json
+	summaryPath string
+}
+
+func addSwitchFlags(cmd *cobra.Command, options *switchOptions) {
+	cmd.Flags().StringArrayVar(&options.globs, "match", nil, "also select the repositories whose name matches this glob, like '*-experiment'. Repeatable")
+	cmd.Flags().StringArrayVar(&options.regularExpressions, "regex", nil, "also select the repositories whose name matches this regular expression, like '^aoc-20[0-9]{2}$'. Repeatable")
+	cmd.Flags().BoolVarP(&options.yes, "yes", "y", false, "don't ask for confirmation before switching the repositories selected by --match or --regex")
+	cmd.Flags().StringVar(&options.fromFile, "from-file", "", "switch the repositories listed in this file, - for standard input. See --input-format")
+	cmd.Flags().StringVar(&options.inputFormat, "input-format", "text", fmt.Sprintf("format of --from-file: %s. text is one owner/name per line with # comments, json is an array of names or of objects with a full_name", strings.Join(inputFormats, "|")))
+	addOrganizationFlag(cmd)
+	addSkipPolicyFlags(cmd)
+	addOutputFlags(cmd, &options.output, switchResultFields, defaultSwitchResultFields)
+	addSummaryFlag(cmd, &options.summaryPath)
+}
+
+// runSwitch switches the repositories named in args, and the ones selected by --match and --regex,
+// to targetVisibility. Patterns are resolved against the whole listing, and confirmed before anything changes
+func runSwitch(cmd *cobra.Command, args []string, targetVisibility ghpm.Visibility, options switchOptions) error {
+
+	if options.fromFile != "" {
+
+		if len(args) > 0 || len(options.globs) > 0 || len(options.regularExpressions) > 0 {
+			return errors.New("--from-file can't be combined with names, --match or --regex")
+		}
+
+		if options.fromFile == "-" && withTokenFlag {
+			return errors.New("--from-file - and --with-token both read standard input, give the token with GHPM_TOKEN or ghpm login instead")
+		}
+
+		return runBatchSwitch(cmd, targetVisibility, options)
+	}
+
+	selector, err := ghpm.NewRepositorySelector(options.globs, options.regularExpressions)
+
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 && selector.IsEmpty() {
+		return errors.New("give at least one repository name, --match or --regex")
+	}
+
+	ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	repositories, err := ghPrivacyManager.SelectRepositories(cmd.Context(), args, selector)
+
+	if err != nil {
+		return err
+	}
+
+	if len(repositories) == 0 {
+		return errors.New("no repository matches")
+	}
+
+	if !selector.IsEmpty() && !options.yes {
+
+		confirmed, err := confirmSwitch(cmd, ghPrivacyManager.PlanRepositoriesVisibility(repositories, targetVisibility), targetVisibility)
+
+		if err != nil {
+			return err
+		}
+
+		if !confirmed {
+
+			fmt.Fprintln(cmd.ErrOrStderr(), "nothing was switched")
+
+			return nil
+		}
+	}
+
+	results := ghPrivacyManager.SwitchRepositoriesVisibility(cmd.Context(), repositories, targetVisibility)
+
+	namedRepositories := make(map[string]bool, len(args))
+
+	for _, repositoryName := range args {
+		namedRepositories[strings.ToLower(ghPrivacyManager.RepositoryFullname(repositoryName))] = true
+	}
+
+	// a repository named in args and also matched by a pattern was still asked for by name
+	named := func(result ghpm.SwitchResult) bool {
+		return namedRepositories[strings.ToLower(result.Repository.Fullname)]
+	}
+
+	return reportSwitch(cmd, results, options.output, options.summaryPath, named)
+}
+
+// runBatchSwitch switches every repository of --from-file, then prints one result per line
+func runBatchSwitch(cmd *cobra.Command, targetVisibility ghpm.Visibility, options switchOptions) error {
+
+	lines, err := readBatchFile(cmd, options.fromFile, options.inputFormat)
+
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 0 {
+		return fmt.Errorf("no repository in %s", options.fromFile)
+	}
+
+	ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	repositoryNames := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		repositoryNames = append(repositoryNames, line.repositoryName)
+	}
+
+	switchResults := ghPrivacyManager.SwitchRepositoriesByName(cmd.Context(), repositoryNames, targetVisibility)
+
+	results := make([]batchResult, 0, len(lines))
+
+	for index, line := range lines {
+		results = append(results, batchResult{line: line, result: switchResults[index]})
+	}
+
+	batchOutput := options.output
+
+	// --fields defaults to the ones of a switch, which have no line number
+	if !cmd.Flags().Changed("fields") {
+		batchOutput.fields = defaultBatchResultFields
+	}
+
+	if err := printRecords(cmd.OutOrStdout(), results, batchResultFields, batchOutput); err != nil {
+		return err
+	}
+
+	return summarizeSwitch(switchResults, options.summaryPath, allNamed)
+}
+
+// confirmSwitch shows the plan on standard error and asks to go on. Anything but y or yes is a no.
+// When nothing would be switched there is nothing to confirm: it goes on without asking, for the skips to be reported
+func confirmSwitch(cmd *cobra.Command, plan []ghpm.SwitchResult, targetVisibility ghpm.Visibility) (bool, error) {
+
+	planned := 0
+
+	for _, result := range plan {
+		if result.Outcome == ghpm.OutcomePlanned {
+			planned++
+		}
+	}
+
+	if planned == 0 {
+		return true, nil
+	}
+
+	err := printRecords(cmd.ErrOrStderr(), plan, switchResultFields, outputOptions{format: "table", fields: []string{"full_name", "visibility", "stargazers_count", "outcome", "reason"}})
+
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "switch %d repositories to %s? [y/N] ", planned, targetVisibility)
+
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+
+	if err != nil && answer == "" {
+		return false, errors.New("could not read the confirmation from standard input, use --yes to skip it")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
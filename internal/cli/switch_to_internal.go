@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var switchToInternalOptions switchOptions
+
+var switchToInternalCmd = &cobra.Command{
+	Use:   "switch_internal [name...]",
+	Short: "Switch a repository of your enterprise organization to internal by name",
+	Args:  cobra.ArbitraryArgs,
+	Long: heredoc.Docf(`
+		Switch a repository of your enterprise organization to internal by name.
+
+		Internal repositories are visible to every member of the enterprise, and to no one else.
+		Only organizations owned by an enterprise have them.
+
+		Switching a public repository to internal goes through the same skip policy as switching it to private:
+		by default, starred repositories and forks are not switched.
+		Change that with %[1]s--max-stars%[1]s and %[1]s--include-forks%[1]s.
+
+		Several names can be given. %[1]s--match%[1]s (glob) and %[1]s--regex%[1]s also select every repository
+		of the listing (yours, or the organization's with %[1]s--org%[1]s) whose name matches.
+		The selection is shown and must be confirmed before anything changes, unless %[1]s--yes%[1]s.
+		Repositories are switched concurrently, %[1]s--concurrency%[1]s at a time, pausing when github rate limits ghpm.
+
+		%[1]s--from-file%[1]s switches the repositories listed in a file (%[1]s-%[1]s for standard input) instead:
+		one owner/name per line, with %[1]s#%[1]s comments, or a json array with %[1]s--input-format json%[1]s.
+		Each line gets its own result, with the extra fields %[1]sline%[1]s and %[1]sinput%[1]s.
+	`, "`"),
+	Example: heredoc.Doc(`
+		$ ghpm switch_internal my-org/<name here>
+		$ ghpm switch_internal --org my-org <name here>
+
+		# every experiment at once
+		$ ghpm switch_internal --match '*-experiment' --regex '^aoc-20[0-9]{2}$'
+
+		# from a file, or from another ghpm
+		$ ghpm switch_internal --from-file repos.txt
+		$ ghpm list_public --output json | ghpm switch_internal --from-file - --input-format json
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSwitch(cmd, args, ghpm.VisibilityInternal, switchToInternalOptions)
+	},
+}
+
+func init() {
+	addSwitchFlags(switchToInternalCmd, &switchToInternalOptions)
+	rootCmd.AddCommand(switchToInternalCmd)
+}
@@ -1,55 +1,58 @@
 package cli
 
 import (
-	"log"
-	"net/http"
-
 	"github.com/MakeNowJust/heredoc"
 	"github.com/Neal-C/ghpm/internal/ghpm"
 	"github.com/spf13/cobra"
 )
 
+var switchToPrivateOptions switchOptions
+
 var switchToPrivateCmd = &cobra.Command{
-	Use:   "switch_private",
+	Use:   "switch_private [name...]",
 	Short: "Switch your public repository to private by name",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.ArbitraryArgs,
 	Long: heredoc.Docf(`
 		Switch your public repository to private by name.
 
-		By default, starred repositories with 1 stars will not be made private.
+		By default, starred repositories, forks and your profile README repository will not be made private.
+		Change that with %[1]s--max-stars%[1]s, %[1]s--include-forks%[1]s and %[1]s--allow-readme-repo%[1]s,
+		or with %[1]sskip_policy%[1]s in %[1]sconfig.json%[1]s, in your config directory.
 
 		Starts interactive setup and does a HTTP request to turn your repository private.
+
+		Several names can be given. %[1]s--match%[1]s (glob) and %[1]s--regex%[1]s also select every repository
+		of the listing (yours, or the organization's with %[1]s--org%[1]s) whose name matches.
+		The selection is shown and must be confirmed before anything changes, unless %[1]s--yes%[1]s.
+		Repositories are switched concurrently, %[1]s--concurrency%[1]s at a time, pausing when github rate limits ghpm.
+
+		%[1]s--from-file%[1]s switches the repositories listed in a file (%[1]s-%[1]s for standard input) instead:
+		one owner/name per line, with %[1]s#%[1]s comments, or a json array with %[1]s--input-format json%[1]s.
+		Each line gets its own result, with the extra fields %[1]sline%[1]s and %[1]sinput%[1]s.
 	`, "`"),
 	Example: heredoc.Doc(`
 		# Starts interactive setup 
 		and switches your repository to private by name
 		
-		$ ghpm switch_public <name here>
-		`),
-	RunE: func(cmd *cobra.Command, args []string) error {
-
-		token, err := ghpm.LoginToGithubWithDetecFlow()
+		$ ghpm switch_private <name here>
 
-		if err != nil {
-			return err
-		}
+		# a repository of an organization you administer
+		$ ghpm switch_private my-org/<name here>
+		$ ghpm switch_private --org my-org <name here>
 
-		ghPrivacyManager := ghpm.NewGithubPrivacyManager(token, http.DefaultClient)
+		# every experiment at once
+		$ ghpm switch_private --match '*-experiment' --regex '^aoc-20[0-9]{2}$'
 
-		name := args[0]
-
-		err = ghPrivacyManager.SwitchRepoToPrivateByName(cmd.Context(), name)
-
-		if err != nil {
-			return err
-		}
-
-		log.Printf("success. %s was made private", name)
-
-		return nil
+		# from a file, or from another ghpm
+		$ ghpm switch_private --from-file repos.txt
+		$ ghpm list_public --output json | ghpm switch_private --from-file - --input-format json
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSwitch(cmd, args, ghpm.VisibilityPrivate, switchToPrivateOptions)
 	},
 }
 
 func init() {
+	addSwitchFlags(switchToPrivateCmd, &switchToPrivateOptions)
 	rootCmd.AddCommand(switchToPrivateCmd)
 }
@@ -1,54 +1,54 @@
 package cli
 
 import (
-	"log"
-	"net/http"
-
 	"github.com/MakeNowJust/heredoc"
 	"github.com/Neal-C/ghpm/internal/ghpm"
 	"github.com/spf13/cobra"
 )
 
+var switchToPublicOptions switchOptions
+
 var switchToPublicCmd = &cobra.Command{
-	Use:   "switch_public",
+	Use:   "switch_public [name...]",
 	Short: "Switch your private repository to public by name",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.ArbitraryArgs,
 	Long: heredoc.Docf(`
-		Switch your public repository to private by name.
+		Switch your private repository to public by name.
 
 		Starts interactive setup and does a HTTP request to turn your repository public
+
+		Several names can be given. %[1]s--match%[1]s (glob) and %[1]s--regex%[1]s also select every repository
+		of the listing (yours, or the organization's with %[1]s--org%[1]s) whose name matches.
+		The selection is shown and must be confirmed before anything changes, unless %[1]s--yes%[1]s.
+		Repositories are switched concurrently, %[1]s--concurrency%[1]s at a time, pausing when github rate limits ghpm.
+
+		%[1]s--from-file%[1]s switches the repositories listed in a file (%[1]s-%[1]s for standard input) instead:
+		one owner/name per line, with %[1]s#%[1]s comments, or a json array with %[1]s--input-format json%[1]s.
+		Each line gets its own result, with the extra fields %[1]sline%[1]s and %[1]sinput%[1]s.
 	`, "`"),
 	Example: heredoc.Doc(`
 		# Starts interactive setup 
-		and switches your repository to private by name
+		and switches your repository to public by name
 		
-		$ ghpm switch_private
-		`),
-	RunE: func(cmd *cobra.Command, args []string) error {
-
-		token, err := ghpm.LoginToGithubWithDetecFlow()
+		$ ghpm switch_public <name here>
 
-		if err != nil {
-			return err
-		}
+		# a repository of an organization you administer
+		$ ghpm switch_public my-org/<name here>
+		$ ghpm switch_public --org my-org <name here>
 
-		ghPrivacyManager := ghpm.NewGithubPrivacyManager(token, http.DefaultClient)
-
-		name := args[0]
-
-		err = ghPrivacyManager.SwitchRepoToPublicByName(cmd.Context(), name)
-
-		if err != nil {
-			return err
-		}
-
-		log.Printf("success. %s was made public", name)
-
-		return nil
+		# every experiment at once
+		$ ghpm switch_public --match '*-experiment' --regex '^aoc-20[0-9]{2}$'
 
+		# from a file, or from another ghpm
+		$ ghpm switch_public --from-file repos.txt
+		$ ghpm list_public --output json | ghpm switch_public --from-file - --input-format json
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSwitch(cmd, args, ghpm.VisibilityPublic, switchToPublicOptions)
 	},
 }
 
 func init() {
+	addSwitchFlags(switchToPublicCmd, &switchToPublicOptions)
 	rootCmd.AddCommand(switchToPublicCmd)
 }
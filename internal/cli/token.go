@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+// runID identifies this invocation of ghpm in the journal
+var runID = ghpm.NewRunID()
+
+var (
+	hostnameFlag     string
+	tokenFlag        string
+	withTokenFlag    bool
+	organizationFlag string
+	concurrencyFlag  int
+	maxAttemptsFlag  int
+)
+
+// tokenSource tells where the token used by a command came from
+type tokenSource string
+
+const (
+	tokenSourceFlag       tokenSource = "--token flag"
+	tokenSourceStdin      tokenSource = "standard input (--with-token)"
+	tokenSourceStored     tokenSource = "stored token"
+	tokenSourceDeviceFlow tokenSource = "interactive login"
+	tokenSourceApp        tokenSource = "GitHub App installation"
+)
+
+// currentHostname returns the github host targeted by the command: --hostname, then GHPM_HOST, then the host of the profile.
+// See config.ResolveHostname
+func currentHostname() string {
+
+	if hostnameFlag == "" && os.Getenv("GHPM_HOST") == "" {
+		return config.ResolveHostname(activeProfile.Host)
+	}
+
+	return config.ResolveHostname(hostnameFlag)
+}
+
+// githubTokenSource resolves where the tokens come from, in order :
+// the GitHub App of --app-id or GHPM_APP_ID, --token, --with-token (stdin), GHPM_TOKEN/GH_TOKEN/GITHUB_TOKEN,
+// the stored token of the profile or of the host, and only then the interactive flow, whose result is stored for the next commands
+func githubTokenSource(cmd *cobra.Command, hostname string) (ghpm.TokenSource, tokenSource, error) {
+
+	if _, _, _, configured := appSettings(); configured {
+
+		installation, err := appInstallationTokenSource(hostname)
+
+		return installation, tokenSourceApp, err
+	}
+
+	token, source, err := nonInteractiveGithubAuthToken(cmd, hostname)
+
+	if err == nil {
+		return ghpm.StaticToken(token), source, nil
+	}
+
+	if !errors.Is(err, config.ErrNoStoredToken) {
+		return nil, "", err
+	}
+
+	loginFlow, err := hostLoginFlow(hostname)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &ghpm.DeviceFlowTokenSource{
+		Flow: loginFlow,
+		OnLogin: func(token string) error {
+			return storeToken(hostname, token)
+		},
+	}, tokenSourceDeviceFlow, nil
+}
+
+// nonInteractiveGithubAuthToken is githubTokenSource for personal access tokens only, without the interactive flow.
+// It returns config.ErrNoStoredToken when no token could be found
+func nonInteractiveGithubAuthToken(cmd *cobra.Command, hostname string) (string, tokenSource, error) {
+
+	token, source, err := explicitGithubAuthToken(cmd)
+
+	if err != nil || token != "" {
+		return token, source, err
+	}
+
+	if token, environmentVariable := config.TokenFromEnvironment(); token != "" {
+		return token, tokenSource(environmentVariable + " environment variable"), nil
+	}
+
+	token, err = loadStoredToken(hostname)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, tokenSourceStored, nil
+}
+
+// explicitGithubAuthToken returns the token given with --token or --with-token, if any
+func explicitGithubAuthToken(cmd *cobra.Command) (string, tokenSource, error) {
+
+	if tokenFlag != "" && withTokenFlag {
+		return "", "", errors.New("--token and --with-token cannot be used together")
+	}
+
+	if tokenFlag != "" {
+		return tokenFlag, tokenSourceFlag, nil
+	}
+
+	if withTokenFlag {
+
+		token, err := readToken(cmd.InOrStdin())
+
+		if err != nil {
+			return "", "", err
+		}
+
+		return token, tokenSourceStdin, nil
+	}
+
+	return "", "", nil
+}
+
+// readToken reads the first line of input, as in: ghpm login --with-token < mytoken.txt
+func readToken(input io.Reader) (string, error) {
+
+	if file, ok := input.(*os.File); ok {
+
+		if fileInfo, err := file.Stat(); err == nil && fileInfo.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintln(os.Stderr, "paste your token, then press Enter")
+		}
+	}
+
+	// byte by byte: a buffered reader would swallow what follows the token, like the answer to a confirmation
+	var line []byte
+
+	character := make([]byte, 1)
+
+	for {
+
+		read, err := input.Read(character)
+
+		if read == 1 {
+
+			if character[0] == '\n' {
+				break
+			}
+
+			line = append(line, character[0])
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("could not read the token from standard input: %w", err)
+		}
+	}
+
+	token := strings.TrimSpace(string(line))
+
+	if token == "" {
+		return "", errors.New("--with-token was given but standard input was empty")
+	}
+
+	return token, nil
+}
+
+// loginWithDeviceFlow runs the interactive flow with the OAuth app configured for the host
+func loginWithDeviceFlow(hostname string) (string, error) {
+
+	loginFlow, err := hostLoginFlow(hostname)
+
+	if err != nil {
+		return "", err
+	}
+
+	return loginFlow.Login()
+}
+
+// hostLoginFlow returns the interactive flow of the host, with the OAuth app configured for it
+func hostLoginFlow(hostname string) (ghpm.LoginFlow, error) {
+
+	hostConfig, err := config.LoadHostConfig(hostname)
+
+	if err != nil {
+		return ghpm.LoginFlow{}, err
+	}
+
+	clientID, clientSecret, err := hostConfig.OauthApp(hostname)
+
+	if err != nil {
+		return ghpm.LoginFlow{}, err
+	}
+
+	return ghpm.LoginFlow{
+		HostURL:      fmt.Sprintf("https://%s", hostname),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}, nil
+}
+
+// apiBaseURL returns the REST API root of hostname, unless GHPM_API_URL replaces it
+func apiBaseURL(hostname string) string {
+
+	if override := config.APIURLOverride(); override != "" {
+		return override
+	}
+
+	return ghpm.APIBaseURL(hostname)
+}
+
+func newGithubPrivacyManager(cmd *cobra.Command) (*ghpm.GithubPrivacyManager, error) {
+
+	if concurrencyFlag < 1 {
+		return nil, fmt.Errorf("--concurrency must be at least 1, got %d", concurrencyFlag)
+	}
+
+	if maxAttemptsFlag < 1 {
+		return nil, fmt.Errorf("--max-attempts must be at least 1, got %d", maxAttemptsFlag)
+	}
+
+	hostname := currentHostname()
+
+	tokenSource, source, err := githubTokenSource(cmd, hostname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// an organization given with --org, or by the profile, wins over the one a GitHub App is installed on
+	ghPrivacyManager := ghpm.NewLazyGithubPrivacyManager(apiBaseURL(hostname), tokenSource, http.DefaultClient)
+
+	ghPrivacyManager.SetOrganization(currentOrganization())
+
+	// before Authenticate, whose requests are retried too
+	ghPrivacyManager.SetConcurrency(concurrencyFlag)
+
+	ghPrivacyManager.SetMaxAttempts(maxAttemptsFlag)
+
+	// the token of the profile is known to belong to its username, other tokens may belong to anyone
+	profileToken := source == tokenSourceStored || source == tokenSourceDeviceFlow
+
+	if profileToken && activeProfile.Username != "" {
+		ghPrivacyManager.SetUsername(activeProfile.Username)
+	}
+
+	if err := ghPrivacyManager.Authenticate(cmd.Context()); err != nil {
+		return nil, err
+	}
+
+	if profileToken {
+		if err := rememberProfileUsername(ghPrivacyManager.Username()); err != nil {
+			return nil, err
+		}
+	}
+
+	journalPath, err := config.JournalPath()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ghPrivacyManager.SetJournal(ghpm.NewJournal(journalPath, runID))
+
+	policy, err := skipPolicy(cmd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ghPrivacyManager.SetSkipPolicy(policy)
+
+	ghPrivacyManager.SetPreflightReport(func(refused []ghpm.SwitchResult) {
+		reportPreflight(cmd, refused)
+	})
+
+	return ghPrivacyManager, nil
+}
+
+// currentOrganization returns the organization of --org, then the one of the profile. Empty targets the user
+func currentOrganization() string {
+
+	if organizationFlag != "" {
+		return organizationFlag
+	}
+
+	return activeProfile.Organization
+}
+
+// addOrganizationFlag registers --org on the commands that list or switch repositories
+func addOrganizationFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&organizationFlag, "org", "", "target the repositories of this organization instead of yours. You must be an admin of them to switch them")
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&hostnameFlag, "hostname", "", "github host to target, defaults to GHPM_HOST, then the host of the profile, then github.com")
+	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "", "github token to use instead of the stored one")
+	rootCmd.PersistentFlags().BoolVar(&withTokenFlag, "with-token", false, "read the github token from standard input")
+	rootCmd.PersistentFlags().IntVar(&concurrencyFlag, "concurrency", ghpm.DEFAULT_CONCURRENCY, "how many repositories are switched at the same time. Lower it if github rate limits you")
+	rootCmd.PersistentFlags().IntVar(&maxAttemptsFlag, "max-attempts", ghpm.DEFAULT_MAX_ATTEMPTS, "how many times a request is sent when github fails with a 5xx or a rate limit, the first time included. 1 disables retries")
+}
@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/Neal-C/ghpm/internal/config"
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undoOutput  outputOptions
+	undoRunID   string
+	undoList    bool
+	undoSummary string
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the visibility changes of a previous run.",
+	Args:  cobra.NoArgs,
+	Long: heredoc.Docf(`
+		Revert the visibility changes of a previous run.
+
+		Every visibility change that went through is written to a journal in your config directory,
+		with the ID of the run that made it. %[1]sghpm undo%[1]s replays the changes of a run backward,
+		the last run by default.
+
+		Stars and forks lost by switching a repository to private do not come back.
+
+		A run is only reverted with the host and account that made it. The changes made by
+		%[1]sghpm undo%[1]s are journaled too, as the undo of their run: running %[1]sghpm undo%[1]s twice
+		does not revert the revert. A repository already back to its old visibility is left unchanged.
+	`, "`"),
+	Example: heredoc.Doc(`
+		# revert the last run
+		$ ghpm undo
+
+		# list the journal, to find a run ID
+		$ ghpm undo --list
+
+		# revert a specific run
+		$ ghpm undo --run 20261017T093000Z-a1b2c3
+		`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		journalPath, err := config.JournalPath()
+
+		if err != nil {
+			return err
+		}
+
+		journalEntries, err := ghpm.ReadJournal(journalPath)
+
+		if err != nil {
+			return err
+		}
+
+		if undoList {
+			return printRecords(cmd.OutOrStdout(), journalEntries, journalEntryFields, alternateOutput(cmd, undoOutput, journalEntryFields))
+		}
+
+		if len(journalEntries) == 0 {
+			return fmt.Errorf("the journal %s is empty, there is nothing to undo", journalPath)
+		}
+
+		reverted := revertedEntries(journalEntries)
+
+		targetRunID := undoRunID
+
+		if targetRunID == "" {
+			targetRunID = lastRevertibleRunID(journalEntries)
+		}
+
+		var runEntries []ghpm.JournalEntry
+
+		for _, entry := range journalEntries {
+			if entry.RunID == targetRunID {
+				runEntries = append(runEntries, entry)
+			}
+		}
+
+		if len(runEntries) == 0 {
+			return fmt.Errorf("run %s is not in the journal %s. See: ghpm undo --list", targetRunID, journalPath)
+		}
+
+		if undoneRunID := runEntries[0].UndoOf; undoneRunID != "" {
+			return fmt.Errorf("run %s is the undo of run %s, it can't be undone in turn. Switch the repositories back by hand", targetRunID, undoneRunID)
+		}
+
+		var pendingEntries []ghpm.JournalEntry
+
+		for _, entry := range runEntries {
+			if _, found := reverted[revertedEntry{entry.RunID, entry.Repository}]; !found {
+				pendingEntries = append(pendingEntries, entry)
+			}
+		}
+
+		if len(pendingEntries) == 0 {
+			return fmt.Errorf("run %s was undone already. Undo an older one with --run, see: ghpm undo --list", targetRunID)
+		}
+
+		ghPrivacyManager, err := newGithubPrivacyManager(cmd)
+
+		if err != nil {
+			return err
+		}
+
+		if err := checkSameAccount(ghPrivacyManager, pendingEntries[0]); err != nil {
+			return err
+		}
+
+		// a later ghpm undo must know these changes revert targetRunID, and not revert them in turn
+		ghPrivacyManager.SetJournal(ghpm.NewUndoJournal(journalPath, runID, targetRunID))
+
+		// backward, so that a repository switched twice in the run ends up as it was before the run
+		slices.Reverse(pendingEntries)
+
+		results := make([]ghpm.SwitchResult, 0, len(pendingEntries))
+
+		for _, entry := range pendingEntries {
+			results = append(results, ghPrivacyManager.SwitchRepositoryByName(cmd.Context(), entry.Repository, entry.From))
+		}
+
+		// the journal names each repository: one ghpm refuses to switch back is not undone
+		return reportSwitch(cmd, results, undoOutput, undoSummary, allNamed)
+	},
+}
+
+// journalEntryFields : the columns of ghpm undo --list
+var journalEntryFields = []field[ghpm.JournalEntry]{
+	{"time", func(entry ghpm.JournalEntry) any { return entry.Time }},
+	{"run_id", func(entry ghpm.JournalEntry) any { return entry.RunID }},
+	{"full_name", func(entry ghpm.JournalEntry) any { return entry.Repository }},
+	{"from", func(entry ghpm.JournalEntry) any { return entry.From }},
+	{"to", func(entry ghpm.JournalEntry) any { return entry.To }},
+	{"undo_of", func(entry ghpm.JournalEntry) any { return entry.UndoOf }},
+}
+
+// revertedEntry : a repository of a run, that a run of ghpm undo switched back
+type revertedEntry struct {
+	runID string
+
+	repository string
+}
+
+// revertedEntries returns the changes that ghpm undo already switched back, and the run of ghpm undo that did
+func revertedEntries(journalEntries []ghpm.JournalEntry) map[revertedEntry]string {
+
+	reverted := map[revertedEntry]string{}
+
+	for _, entry := range journalEntries {
+		if entry.UndoOf != "" {
+			reverted[revertedEntry{entry.UndoOf, entry.Repository}] = entry.RunID
+		}
+	}
+
+	return reverted
+}
+
+// lastRevertibleRunID returns the last run that is not itself a ghpm undo. Running ghpm undo twice must not revert the revert
+func lastRevertibleRunID(journalEntries []ghpm.JournalEntry) string {
+
+	for index := len(journalEntries) - 1; index >= 0; index-- {
+		if journalEntries[index].UndoOf == "" {
+			return journalEntries[index].RunID
+		}
+	}
+
+	return ""
+}
+
+// checkSameAccount refuses to replay entry with another account or on another host than the ones that made it:
+// owner/name could be another repository there
+func checkSameAccount(ghPrivacyManager *ghpm.GithubPrivacyManager, entry ghpm.JournalEntry) error {
+
+	if entry.APIBaseURL == "" || entry.Username == "" {
+		return fmt.Errorf("run %s was journaled by an older ghpm, that did not record on which host and as whom. Switch its repositories back by hand", entry.RunID)
+	}
+
+	if entry.APIBaseURL != ghPrivacyManager.APIBaseURL() || !strings.EqualFold(entry.Username, ghPrivacyManager.Username()) {
+		return fmt.Errorf("run %s was made as %s on %s, but ghpm now acts as %s on %s. Use the same --hostname, --profile or token", entry.RunID, entry.Username, entry.APIBaseURL, ghPrivacyManager.Username(), ghPrivacyManager.APIBaseURL())
+	}
+
+	return nil
+}
+
+func init() {
+	undoCmd.Flags().StringVar(&undoRunID, "run", "", "ID of the run to revert, the last run when empty")
+	undoCmd.Flags().BoolVar(&undoList, "list", false, "list the journal instead of reverting anything")
+	addOutputFlags(undoCmd, &undoOutput, switchResultFields, defaultSwitchResultFields)
+	addAlternateFields(undoCmd, "--list", journalEntryFields)
+	addSummaryFlag(undoCmd, &undoSummary)
+	addSkipPolicyFlags(undoCmd)
+	rootCmd.AddCommand(undoCmd)
+}
@@ -1,6 +1,8 @@
 // package for everything related to configuration
 package config
 
+import "os"
+
 var (
 	// The "ghpm CLI" OAuth app
 	// This value is safe to be embedded in version control
@@ -15,3 +17,27 @@ var (
 
 	MinimumScopes = []string{"repo"}
 )
+
+// TokenEnvironmentVariables : checked in order, the first one set wins
+var TokenEnvironmentVariables = []string{"GHPM_TOKEN", "GH_TOKEN", "GITHUB_TOKEN"}
+
+// TokenFromEnvironment returns the first token found in TokenEnvironmentVariables
+// along with the name of the variable it was read from
+func TokenFromEnvironment() (token string, environmentVariable string) {
+
+	for _, environmentVariable := range TokenEnvironmentVariables {
+
+		if token := os.Getenv(environmentVariable); token != "" {
+			return token, environmentVariable
+		}
+	}
+
+	return "", ""
+}
+
+// The GitHub App ghpm acts as when no --app-* flag is given. GHPM_APP_PRIVATE_KEY is the path of the .pem file
+const (
+	AppIDEnvironmentVariable             = "GHPM_APP_ID"
+	AppInstallationIDEnvironmentVariable = "GHPM_APP_INSTALLATION_ID"
+	AppPrivateKeyEnvironmentVariable     = "GHPM_APP_PRIVATE_KEY"
+)
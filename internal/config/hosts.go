@@ -0,0 +1,255 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// APIURLEnvironmentVariable replaces the REST API root of the host, see APIURLOverride
+const APIURLEnvironmentVariable = "GHPM_API_URL"
+
+// APIURLOverride returns the REST API root set in GHPM_API_URL, empty when unset.
+// For proxies, and to point ghpm at a fake github in tests
+func APIURLOverride() string {
+	return strings.TrimSuffix(os.Getenv(APIURLEnvironmentVariable), "/")
+}
+
+// DefaultHostname : the host used when neither --hostname nor GHPM_HOST is given
+const DefaultHostname = "github.com"
+
+// ErrNoStoredToken : returned when ghpm login was never run for a host (or ghpm logout was run)
+var ErrNoStoredToken = errors.New("no stored token")
+
+// HostConfig is what ghpm remembers about one github host
+type HostConfig struct {
+	OauthToken string `json:"oauth_token,omitempty"`
+
+	// The embedded OAuth app only exists on github.com.
+	// On a GitHub Enterprise Server, register an OAuth app and put its credentials here
+	OauthClientID string `json:"oauth_client_id,omitempty"`
+
+	OauthClientSecret string `json:"oauth_client_secret,omitempty"`
+}
+
+// Hosts is the on-disk representation of hosts.json, keyed by hostname
+type Hosts map[string]HostConfig
+
+// ResolveHostname returns the hostname given by flag, then GHPM_HOST, then DefaultHostname.
+// Scheme and trailing slashes are stripped so that "https://github.example.com/" works too
+func ResolveHostname(hostnameFlag string) string {
+
+	hostname := hostnameFlag
+
+	if hostname == "" {
+		hostname = os.Getenv("GHPM_HOST")
+	}
+
+	if hostname == "" {
+		return DefaultHostname
+	}
+
+	hostname = strings.TrimPrefix(hostname, "https://")
+	hostname = strings.TrimPrefix(hostname, "http://")
+
+	return strings.ToLower(strings.TrimRight(hostname, "/"))
+}
+
+// ConfigDir returns the per-user directory where ghpm keeps its state.
+// It can be overridden with the GHPM_CONFIG_DIR environment variable
+func ConfigDir() (string, error) {
+
+	if configDir := os.Getenv("GHPM_CONFIG_DIR"); configDir != "" {
+		return configDir, nil
+	}
+
+	userConfigDir, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userConfigDir, "ghpm"), nil
+}
+
+// HostsPath returns the path of the file holding the per-host configuration and tokens
+func HostsPath() (string, error) {
+
+	configDir, err := ConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "hosts.json"), nil
+}
+
+// LoadHosts returns the content of hosts.json. A missing file is an empty configuration
+func LoadHosts() (Hosts, error) {
+
+	hostsPath, err := HostsPath()
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(hostsPath)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return Hosts{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := Hosts{}
+
+	if err := json.Unmarshal(content, &hosts); err != nil {
+		return nil, fmt.Errorf("%s is corrupted, fix it or delete it then run ghpm login: %w", hostsPath, err)
+	}
+
+	return hosts, nil
+}
+
+// SaveHosts writes hosts.json, readable by the current user only
+func SaveHosts(hosts Hosts) error {
+
+	hostsPath, err := HostsPath()
+
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(hosts, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFilePrivately(hostsPath, content)
+}
+
+// LoadHostConfig returns the configuration of a single host, empty if unknown
+func LoadHostConfig(hostname string) (HostConfig, error) {
+
+	hosts, err := LoadHosts()
+
+	if err != nil {
+		return HostConfig{}, err
+	}
+
+	return hosts[hostname], nil
+}
+
+// LoadToken returns the token stored by ghpm login for the host, or ErrNoStoredToken
+func LoadToken(hostname string) (string, error) {
+
+	hostConfig, err := LoadHostConfig(hostname)
+
+	if err != nil {
+		return "", err
+	}
+
+	if hostConfig.OauthToken == "" {
+		return "", ErrNoStoredToken
+	}
+
+	return hostConfig.OauthToken, nil
+}
+
+// SaveToken stores the token of the host in the config directory, readable by the current user only
+func SaveToken(hostname string, token string) error {
+
+	hosts, err := LoadHosts()
+
+	if err != nil {
+		return err
+	}
+
+	hostConfig := hosts[hostname]
+
+	hostConfig.OauthToken = token
+
+	hosts[hostname] = hostConfig
+
+	return SaveHosts(hosts)
+}
+
+// DeleteToken removes the stored token of the host, and keeps the rest of its configuration.
+// Deleting a token that does not exist is not an error
+func DeleteToken(hostname string) error {
+
+	hosts, err := LoadHosts()
+
+	if err != nil {
+		return err
+	}
+
+	hostConfig, ok := hosts[hostname]
+
+	if !ok {
+		return nil
+	}
+
+	hostConfig.OauthToken = ""
+
+	if hostConfig == (HostConfig{}) {
+		delete(hosts, hostname)
+	} else {
+		hosts[hostname] = hostConfig
+	}
+
+	return SaveHosts(hosts)
+}
+
+// OauthApp returns the OAuth app credentials to use for the device flow on a host
+func (self HostConfig) OauthApp(hostname string) (clientID string, clientSecret string, err error) {
+
+	if self.OauthClientID != "" {
+		return self.OauthClientID, self.OauthClientSecret, nil
+	}
+
+	if hostname == DefaultHostname {
+		return OauthClientID, OauthClientSecret, nil
+	}
+
+	return "", "", fmt.Errorf("no OAuth app configured for %s. Use --with-token, or set oauth_client_id and oauth_client_secret for it in hosts.json", hostname)
+}
+
+// writeFilePrivately writes through a temporary file then renames it,
+// so that a crash never leaves a half written file behind. The file ends up with 0600 permissions
+func writeFilePrivately(path string, content []byte) error {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	temporaryFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temporaryFile.Name())
+
+	if err := temporaryFile.Chmod(0o600); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+
+	if _, err := temporaryFile.Write(content); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryFile.Name(), path)
+}
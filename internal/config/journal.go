@@ -0,0 +1,15 @@
+package config
+
+import "path/filepath"
+
+// JournalPath returns the path of the journal of visibility changes, read by ghpm undo
+func JournalPath() (string, error) {
+
+	configDir, err := ConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "journal.jsonl"), nil
+}
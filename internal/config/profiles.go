@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ProfileEnvironmentVariable selects a profile when --profile is not given, see ResolveProfileName
+const ProfileEnvironmentVariable = "GHPM_PROFILE"
+
+// ErrNoProfile : the profile asked for does not exist in profiles.json
+var ErrNoProfile = errors.New("no such profile")
+
+// Profile : one of the accounts of the user, a personal account, a work account, a bot.
+// Empty values fall back to the configuration without profile: GHPM_HOST, hosts.json, config.json
+type Profile struct {
+	Host string `json:"host,omitempty"`
+
+	OauthToken string `json:"oauth_token,omitempty"`
+
+	// login of the account the token belongs to, recorded by ghpm login
+	Username string `json:"username,omitempty"`
+
+	// targeted instead of the user, like --org
+	Organization string `json:"organization,omitempty"`
+
+	// overrides the skip policy of config.json
+	SkipPolicy SkipPolicySettings `json:"skip_policy"`
+}
+
+// Profiles is the on-disk representation of profiles.json
+type Profiles struct {
+	// name of the profile used when neither --profile nor GHPM_PROFILE is given. Empty for none
+	Active string `json:"active,omitempty"`
+
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Names returns the names of the profiles, sorted
+func (self Profiles) Names() []string {
+
+	names := make([]string, 0, len(self.Profiles))
+
+	for name := range self.Profiles {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// ResolveProfileName returns the profile given by flag, then GHPM_PROFILE, then the active profile of profiles.
+// Empty when none is: ghpm runs without profile
+func ResolveProfileName(profileFlag string, profiles Profiles) string {
+
+	if profileFlag != "" {
+		return profileFlag
+	}
+
+	if profileName := os.Getenv(ProfileEnvironmentVariable); profileName != "" {
+		return profileName
+	}
+
+	return profiles.Active
+}
+
+// Profile returns the profile called name, or ErrNoProfile
+func (self Profiles) Profile(name string) (Profile, error) {
+
+	profile, found := self.Profiles[name]
+
+	if !found {
+
+		known := strings.Join(self.Names(), ", ")
+
+		if known == "" {
+			known = "none"
+		}
+
+		return Profile{}, fmt.Errorf("%w %q (known: %s)", ErrNoProfile, name, known)
+	}
+
+	return profile, nil
+}
+
+// ProfilesPath returns the path of the file holding the profiles and their tokens
+func ProfilesPath() (string, error) {
+
+	configDir, err := ConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "profiles.json"), nil
+}
+
+// LoadProfiles returns the content of profiles.json. A missing file means no profile
+func LoadProfiles() (Profiles, error) {
+
+	profilesPath, err := ProfilesPath()
+
+	if err != nil {
+		return Profiles{}, err
+	}
+
+	content, err := os.ReadFile(profilesPath)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return Profiles{Profiles: map[string]Profile{}}, nil
+	}
+
+	if err != nil {
+		return Profiles{}, err
+	}
+
+	var profiles Profiles
+
+	if err := json.Unmarshal(content, &profiles); err != nil {
+		return Profiles{}, fmt.Errorf("%s is corrupted, fix it or delete it: %w", profilesPath, err)
+	}
+
+	if profiles.Profiles == nil {
+		profiles.Profiles = map[string]Profile{}
+	}
+
+	return profiles, nil
+}
+
+// SaveProfiles writes profiles.json, readable by the current user only: it holds tokens
+func SaveProfiles(profiles Profiles) error {
+
+	profilesPath, err := ProfilesPath()
+
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(profiles, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFilePrivately(profilesPath, content)
+}
+
+// UpdateProfile applies update to the profile called name, created if needed, and saves profiles.json
+func UpdateProfile(name string, update func(profile *Profile)) error {
+
+	profiles, err := LoadProfiles()
+
+	if err != nil {
+		return err
+	}
+
+	profile := profiles.Profiles[name]
+
+	update(&profile)
+
+	profiles.Profiles[name] = profile
+
+	return SaveProfiles(profiles)
+}
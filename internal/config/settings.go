@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Settings is the on-disk representation of config.json, the user preferences.
+// Unset values keep the ghpm defaults, flags override them
+type Settings struct {
+	SkipPolicy SkipPolicySettings `json:"skip_policy"`
+}
+
+// SkipPolicySettings : see ghpm.SkipPolicy
+type SkipPolicySettings struct {
+	MaxStars *uint `json:"max_stars,omitempty"`
+
+	IncludeForks *bool `json:"include_forks,omitempty"`
+
+	AllowReadmeRepository *bool `json:"allow_readme_repository,omitempty"`
+}
+
+// SettingsPath returns the path of config.json
+func SettingsPath() (string, error) {
+
+	configDir, err := ConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+// LoadSettings returns the content of config.json. A missing file means every default
+func LoadSettings() (Settings, error) {
+
+	settingsPath, err := SettingsPath()
+
+	if err != nil {
+		return Settings{}, err
+	}
+
+	content, err := os.ReadFile(settingsPath)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return Settings{}, nil
+	}
+
+	if err != nil {
+		return Settings{}, err
+	}
+
+	var settings Settings
+
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return Settings{}, fmt.Errorf("%s is invalid: %w", settingsPath, err)
+	}
+
+	return settings, nil
+}
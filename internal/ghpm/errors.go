@@ -0,0 +1,132 @@
+package ghpm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentinel errors, compare with errors.Is. The errors returned by ghpm wrap them, most often through an *APIError
+var (
+	// the repository, organization or user does not exist, or the token can't see it
+	ErrNotFound = errors.New("not found")
+
+	// github rejected the token: expired, revoked, or mistyped
+	ErrUnauthorized = errors.New("bad credentials")
+
+	// the token is not allowed to do that
+	ErrForbidden = errors.New("forbidden")
+
+	// github refused because of its primary or secondary rate limits, even after waiting and retrying
+	ErrRateLimited = errors.New("rate limited by github")
+)
+
+// ErrProtectedRepository : the repository was left as is on purpose, by the skip policy or because it is the profile README.
+// Not a failure of github, a decision of ghpm
+type ErrProtectedRepository struct {
+	Reason string
+}
+
+func (self ErrProtectedRepository) Error() string {
+	return self.Reason
+}
+
+// ErrMissingScopes : the classic token was granted fewer scopes than ghpm needs. See config.MinimumScopes
+type ErrMissingScopes struct {
+	Missing []string
+
+	Granted []string
+}
+
+func (self ErrMissingScopes) Error() string {
+
+	granted := strings.Join(self.Granted, ", ")
+
+	if granted == "" {
+		granted = "none"
+	}
+
+	return fmt.Sprintf("the token is missing the %s scope (granted: %s)", strings.Join(self.Missing, ", "), granted)
+}
+
+// Is makes errors.Is(err, ErrForbidden) true: the token is not allowed to change visibilities
+func (self ErrMissingScopes) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// APIError : github answered with an error status. Message and DocumentationURL come from the json body github sends with it
+type APIError struct {
+	Status int
+
+	Message string
+
+	DocumentationURL string
+
+	// a 403 is a rate limit or a permission error, only the headers and the message tell
+	rateLimited bool
+}
+
+func (self *APIError) Error() string {
+
+	if self.Message == "" {
+		return fmt.Sprintf("github answered %d %s", self.Status, http.StatusText(self.Status))
+	}
+
+	return fmt.Sprintf("github answered %d: %s", self.Status, self.Message)
+}
+
+// Is makes errors.Is(err, ErrNotFound), ErrUnauthorized, ErrForbidden and ErrRateLimited work on an *APIError
+func (self *APIError) Is(target error) bool {
+
+	switch target {
+	case ErrNotFound:
+		return self.Status == http.StatusNotFound
+	case ErrUnauthorized:
+		return self.Status == http.StatusUnauthorized
+	case ErrForbidden:
+		return self.Status == http.StatusForbidden && !self.rateLimited
+	case ErrRateLimited:
+		return self.rateLimited
+	}
+
+	return false
+}
+
+// newAPIError reads the error github sent with httpResponse. Its body is consumed
+func newAPIError(httpResponse *http.Response) *APIError {
+
+	_, rateLimited := rateLimitResumeTime(httpResponse, time.Now())
+
+	apiError := &APIError{
+		Status:      httpResponse.StatusCode,
+		rateLimited: rateLimited || httpResponse.StatusCode == http.StatusTooManyRequests,
+	}
+
+	var body struct {
+		Message string `json:"message"`
+
+		DocumentationURL string `json:"documentation_url"`
+	}
+
+	// not every error has a json body, proxies of GitHub Enterprise Server instances answer html
+	if err := json.NewDecoder(io.LimitReader(httpResponse.Body, 1<<20)).Decode(&body); err == nil {
+		apiError.Message = body.Message
+		apiError.DocumentationURL = body.DocumentationURL
+	}
+
+	return apiError
+}
+
+// failedResult : the repository could not be switched because of err
+func failedResult(repo GithubRepository, err error) SwitchResult {
+	return SwitchResult{Repository: repo, Outcome: OutcomeFailed, Reason: err.Error(), Err: err}
+}
+
+// protectedResult : ghpm leaves the repository as is on purpose
+func protectedResult(repo GithubRepository, reason string) SwitchResult {
+	return SwitchResult{Repository: repo, Outcome: OutcomeSkipped, Reason: reason, Err: ErrProtectedRepository{Reason: reason}}
+}
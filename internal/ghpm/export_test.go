@@ -0,0 +1,4 @@
+package ghpm
+
+// NextPageURL exposes nextPageURL to the tests of package ghpm_test
+var NextPageURL = nextPageURL
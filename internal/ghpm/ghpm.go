@@ -5,24 +5,61 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"iter"
 	"log"
 	"net/http"
+	"net/url"
 	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/config"
 )
 
-// STARS_THRESHOLD : the required numbers of stars on a repository for it be avoided by ghpm
-const STARS_THRESHOLD uint = 1
+// APIBaseURL returns the root of the REST API for a github host.
+// github.com is served from api.github.com, GitHub Enterprise Server from https://HOST/api/v3
+func APIBaseURL(hostname string) string {
+
+	if hostname == "" || hostname == "github.com" {
+		return "https://api.github.com"
+	}
+
+	return fmt.Sprintf("https://%s/api/v3", hostname)
+}
 
 type GithubPrivacyManager struct {
-	// token that allows requesting github on behalf of the user
-	githubAuthToken string
-	// httpClient that does the requests
+	// root of the REST API, without trailing slash. See APIBaseURL
+	apiBaseURL string
+	// where the token of every request comes from: a personal access token, the device flow, a GitHub App installation
+	tokenSource TokenSource
+	// httpClient that does the requests, authenticated by tokenSource
 	httpClient *http.Client
-	// the username for the user that did the oauth authentication process
+	// the transport of httpClient, kept to configure it
+	retryTransport *retryTransport
+	// the username for the user that did the oauth authentication process. Empty until Authenticate, or SetUsername
 	username string
+	// Authenticate succeeded, github accepted the token
+	authenticated bool
+	// of the token, read by Authenticate. scopesKnown is false when github sent no X-OAuth-Scopes
+	scopes      []string
+	scopesKnown bool
+	// Authenticate runs once, even from concurrent workers
+	authenticationMutex sync.Mutex
+	// where successful visibility changes are recorded for ghpm undo. Nothing is recorded when nil
+	journal *Journal
+	// which repositories are never switched to private
+	skipPolicy SkipPolicy
+	// when set, listings and bare repository names target this organization instead of the user
+	organization string
+	// the token is the one of a GitHub App installed on a user account, that /user/repos does not answer. See ownedRepositories
+	userInstallation bool
+	// how many repositories are switched at the same time. See SetConcurrency
+	concurrency int
+	// told about the repositories the token can't change, before a bulk switch. See SetPreflightReport
+	preflightReport func(refused []SwitchResult)
 }
 
 type User struct {
@@ -32,19 +69,97 @@ type User struct {
 type GithubRepository struct {
 	Stars uint `json:"stargazers_count"`
 
+	Name string `json:"name"`
+
 	Fullname string `json:"full_name"`
 
 	Private bool `json:"private"`
 
+	// public, private or internal (GitHub Enterprise organizations only)
+	Visibility string `json:"visibility"`
+
 	IsFork bool `json:"fork"`
+
+	Archived bool `json:"archived"`
+
+	IsTemplate bool `json:"is_template"`
+
+	HasPages bool `json:"has_pages"`
+
+	Forks uint `json:"forks_count"`
+
+	Watchers uint `json:"watchers_count"`
+
+	// zero for a repository that was never pushed to
+	PushedAt time.Time `json:"pushed_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Owner RepositoryOwner `json:"owner"`
+
+	Topics []string `json:"topics"`
+
+	Language string `json:"language"`
+
+	// nil when the repository has no license
+	License *RepositoryLicense `json:"license"`
+
+	DefaultBranch string `json:"default_branch"`
+
+	// in kilobytes
+	Size uint `json:"size"`
+
+	// what the token can do on the repository
+	Permissions RepositoryPermissions `json:"permissions"`
 }
 
-func Prettyfy(data any) (string, error) {
-	val, err := json.MarshalIndent(data, "", "")
-	if err != nil {
-		return "", err
-	}
-	return string(val), nil
+type RepositoryOwner struct {
+	Login string `json:"login"`
+
+	// User or Organization
+	Type string `json:"type"`
+}
+
+type RepositoryLicense struct {
+	Key string `json:"key"`
+
+	SPDXID string `json:"spdx_id"`
+
+	Name string `json:"name"`
+}
+
+type RepositoryPermissions struct {
+	Admin bool `json:"admin"`
+
+	Push bool `json:"push"`
+
+	Pull bool `json:"pull"`
+}
+
+// Outcome of an attempt to switch the visibility of a repository
+type Outcome string
+
+const (
+	// would be switched, nothing was sent to github yet
+	OutcomePlanned  Outcome = "planned"
+	OutcomeSwitched Outcome = "switched"
+	OutcomeSkipped  Outcome = "skipped"
+	OutcomeFailed   Outcome = "failed"
+)
+
+// SwitchResult : what happened to one repository during a switch
+type SwitchResult struct {
+	Repository GithubRepository `json:"repository"`
+
+	Outcome Outcome `json:"outcome"`
+
+	// why it was skipped or why it failed. Empty when switched
+	Reason string `json:"reason,omitempty"`
+
+	// set when failed, and when skipped because of an ErrProtectedRepository. Reason is its message, or a friendlier one
+	Err error `json:"-"`
 }
 
 func ToFullname(repositories []GithubRepository) iter.Seq[string] {
@@ -55,428 +170,650 @@ func ToFullname(repositories []GithubRepository) iter.Seq[string] {
 	}
 }
 
-func NewGithubPrivacyManager(githubAuthToken string, httpClient *http.Client) GithubPrivacyManager {
+// NewGithubPrivacyManager checks the token against github before returning, see Authenticate.
+// It requests github with a copy of httpClient, that waits for github's rate limits and retries transient failures. See SetMaxAttempts.
+// apiBaseURL is usually APIBaseURL(hostname), any other REST API root works: a proxy, or a ghpmtest.Server in tests.
+// tokenSource is a StaticToken for a personal access token, see TokenSource for the others
+func NewGithubPrivacyManager(ctx context.Context, apiBaseURL string, tokenSource TokenSource, httpClient *http.Client) (*GithubPrivacyManager, error) {
 
-	httpRequest, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "https://api.github.com/user", http.NoBody)
+	ghPrivacyManager := NewLazyGithubPrivacyManager(apiBaseURL, tokenSource, httpClient)
 
-	// Authorization
-	httpRequest.Header.Add("Authorization", fmt.Sprintf("Bearer %s", githubAuthToken))
-
-	// Recommended in the github API documentation
-	httpRequest.Header.Add("Accept", "application/vnd.github+json")
+	if err := ghPrivacyManager.Authenticate(ctx); err != nil {
+		return nil, err
+	}
 
-	// Targeted Github API version
-	httpRequest.Header.Add("X-GitHub-Api-Version", "2022-11-28")
+	return ghPrivacyManager, nil
+}
 
-	httpResponse, err := httpClient.Do(httpRequest)
+// NewLazyGithubPrivacyManager is NewGithubPrivacyManager without any request:
+// the token is checked and the username resolved by the first method that needs them
+func NewLazyGithubPrivacyManager(apiBaseURL string, tokenSource TokenSource, httpClient *http.Client) *GithubPrivacyManager {
 
-	if err != nil {
-		log.Fatal("could not fetch username of for the given githubAuthToken. Please complain to the developer")
-	}
+	// innermost, so that every attempt asks tokenSource right before being sent, and a retry after a long rate limit pause gets a refreshed token
+	authenticatedTransport := newAuthTransport(httpClient.Transport, tokenSource)
 
-	defer httpResponse.Body.Close()
+	retryTransport := newRetryTransport(newRateLimitTransport(authenticatedTransport))
 
-	var user User
+	resilientClient := *httpClient
 
-	if err := json.NewDecoder(httpResponse.Body).Decode(&user); err != nil {
-		log.Fatal("could not get the login name (aka username) of for the given githubAuthToken. Please complain to the developer")
-	}
+	resilientClient.Transport = retryTransport
 
-	return GithubPrivacyManager{
-		githubAuthToken: githubAuthToken,
-		httpClient:      httpClient,
-		username:        user.Username,
+	return &GithubPrivacyManager{
+		apiBaseURL:     strings.TrimSuffix(apiBaseURL, "/"),
+		tokenSource:    tokenSource,
+		httpClient:     &resilientClient,
+		retryTransport: retryTransport,
+		skipPolicy:     DefaultSkipPolicy(),
 	}
 }
 
-func (self *GithubPrivacyManager) setRequiredHeadersOnGithubRequest(httpRequest *http.Request) {
+// Authenticate requests /user once: github must accept the token, and tells who it belongs to and its scopes.
+// A classic token without the scopes of config.MinimumScopes fails with ErrMissingScopes.
+// Only the first successful call requests github
+func (self *GithubPrivacyManager) Authenticate(ctx context.Context) error {
 
-	// Authorization
-	httpRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", self.githubAuthToken))
+	self.authenticationMutex.Lock()
 
-	// Recommended in the github API documentation
-	httpRequest.Header.Set("Accept", "application/vnd.github+json")
+	defer self.authenticationMutex.Unlock()
 
-	// Recommended in the github API documentation
-	httpRequest.Header.Set("User-Agent", "ghpm")
+	if self.authenticated {
+		return nil
+	}
 
-	// Targeted Github API version
-	httpRequest.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-}
+	if installation, ok := self.tokenSource.(InstallationTokenSource); ok {
+		return self.authenticateInstallation(ctx, installation)
+	}
 
-func (self *GithubPrivacyManager) ListAllPublicRepositories(ctx context.Context) error {
-	githubAPIEndpoint := "https://api.github.com/user/repos?visibility=public&per_page=100"
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/user", self.apiBaseURL), http.NoBody)
 
-	httpRequest, _ := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIEndpoint, http.NoBody)
+	if err != nil {
+		return err
+	}
 
 	self.setRequiredHeadersOnGithubRequest(httpRequest)
 
 	httpResponse, err := self.httpClient.Do(httpRequest)
 
 	if err != nil {
-		return err
+		return fmt.Errorf("could not reach github to check the token: %w", err)
 	}
 
 	defer httpResponse.Body.Close()
 
-	switch {
-	case httpResponse.StatusCode == http.StatusNotFound:
-
-		return fmt.Errorf("%d : not found. Please complain to the developer", http.StatusNotFound)
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("github did not accept the token: %w", newAPIError(httpResponse))
+	}
 
-	case httpResponse.StatusCode >= 500:
+	var user User
 
-		return fmt.Errorf("github is likely down. Retry. If it does persist: Please complain to the developer")
+	if err := json.NewDecoder(httpResponse.Body).Decode(&user); err != nil {
+		return fmt.Errorf("could not read the user of the token: %w", err)
+	}
 
+	if user.Username == "" {
+		return errors.New("github answered no login for the token")
 	}
 
-	var publicRepositories []GithubRepository
+	scopes, scopesKnown := parseScopes(httpResponse.Header)
 
-	if err := json.NewDecoder(httpResponse.Body).Decode(&publicRepositories); err != nil {
-		return err
+	if missingScopes := missingScopesOf(scopes); scopesKnown && len(missingScopes) > 0 {
+		return ErrMissingScopes{Missing: missingScopes, Granted: scopes}
 	}
 
-	// var namesOfPublicRepositories = make([]string, 0, 100)
+	if self.username != "" && !strings.EqualFold(self.username, user.Username) {
+		return fmt.Errorf("the token belongs to %s, not to %s. Log in again, as %s", user.Username, self.username, self.username)
+	}
 
-	// for _, repo := range publicRepositories {
-	// 	namesOfPublicRepositories = append(namesOfPublicRepositories, repo.Fullname)
-	// }
+	self.authenticated = true
+	self.username = user.Username
+	self.scopes = scopes
+	self.scopesKnown = scopesKnown
 
-	namesOfPublicRepositories := slices.Collect(ToFullname(publicRepositories))
+	return nil
+}
 
-	names, err := Prettyfy(namesOfPublicRepositories)
+// authenticateInstallation is Authenticate for a GitHub App installation, that /user does not answer.
+// The username is the account the app is installed on. An organization becomes the target of listings, unless one was set already.
+// Installation tokens have permissions instead of scopes, the scopes stay unknown
+func (self *GithubPrivacyManager) authenticateInstallation(ctx context.Context, installation InstallationTokenSource) error {
+
+	// the token exchange tells whether github accepts the app, its installation and its private key
+	if _, err := installation.Token(ctx); err != nil {
+		return err
+	}
+
+	account, err := installation.InstallationAccount(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("your public repositories : %s \n", names)
+	if account.Login == "" {
+		return errors.New("github answered no account for the installation")
+	}
+
+	if account.Type == "Organization" && self.organization == "" {
+		self.organization = account.Login
+	}
+
+	self.userInstallation = account.Type != "Organization"
+
+	self.authenticated = true
+	self.username = account.Login
 
 	return nil
 }
 
-func (self *GithubPrivacyManager) ListAllPrivateRepositories(ctx context.Context) error {
+// SetUsername : the login the token is known to belong to, by a profile for example. Authenticate still checks the token,
+// and fails if github says it belongs to someone else, rather than acting on the wrong account
+func (self *GithubPrivacyManager) SetUsername(username string) {
 
-	githubAPIEndpoint := "https://api.github.com/user/repos?visibility=private&per_page=100"
+	self.authenticationMutex.Lock()
 
-	httpRequest, _ := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIEndpoint, http.NoBody)
+	defer self.authenticationMutex.Unlock()
 
-	self.setRequiredHeadersOnGithubRequest(httpRequest)
+	self.username = username
+}
 
-	httpResponse, err := self.httpClient.Do(httpRequest)
+// Username returns the login of the user the token belongs to, or the account a GitHub App is installed on. Empty until Authenticate succeeded or SetUsername
+func (self *GithubPrivacyManager) Username() string {
+	return self.username
+}
 
-	if err != nil {
-		return err
-	}
+// APIBaseURL returns the root of the REST API the manager requests, without trailing slash
+func (self *GithubPrivacyManager) APIBaseURL() string {
+	return self.apiBaseURL
+}
 
-	defer httpResponse.Body.Close()
+// Scopes returns the OAuth scopes of the token, read by Authenticate.
+// known is false for the tokens github sends no X-OAuth-Scopes for: fine-grained tokens and GitHub App tokens
+func (self *GithubPrivacyManager) Scopes() (scopes []string, known bool) {
+	return self.scopes, self.scopesKnown
+}
 
-	switch {
-	case httpResponse.StatusCode == http.StatusNotFound:
+// parseScopes reads X-OAuth-Scopes, a comma separated list. Absent for fine-grained tokens
+func parseScopes(header http.Header) ([]string, bool) {
 
-		return fmt.Errorf("%d : not found. Please complain to the developer", http.StatusNotFound)
+	values, found := header[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+
+	if !found {
+		return nil, false
+	}
 
-	case httpResponse.StatusCode >= 500:
+	var scopes []string
 
-		return fmt.Errorf("github is likely down. Retry. If it does persist: Please complain to the developer")
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
 	}
 
-	var privateRepositories []GithubRepository
+	return scopes, true
+}
 
-	if err := json.NewDecoder(httpResponse.Body).Decode(&privateRepositories); err != nil {
-		return err
+// missingScopesOf returns the scopes of config.MinimumScopes that are not granted
+func missingScopesOf(granted []string) []string {
+
+	var missing []string
+
+	for _, scope := range config.MinimumScopes {
+		if !slices.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
 	}
 
-	// var namesOfPrivateRepositories = make([]string, 0, 100)
+	return missing
+}
 
-	// for _, repo := range privateRepositories {
-	// 	namesOfPrivateRepositories = append(namesOfPrivateRepositories, repo.Fullname)
-	// }
+// SetSkipPolicy replaces DefaultSkipPolicy, for the single repository and the bulk switches alike
+func (self *GithubPrivacyManager) SetSkipPolicy(skipPolicy SkipPolicy) {
+	self.skipPolicy = skipPolicy
+}
 
-	namesOfPrivateRepositories := slices.Collect(ToFullname(privateRepositories))
+// SetOrganization makes listings, bulk switches and bare repository names target an organization.
+// An empty organization targets the authenticated user again
+func (self *GithubPrivacyManager) SetOrganization(organization string) {
+	self.organization = organization
+}
 
-	names, err := Prettyfy(namesOfPrivateRepositories)
+// RepositoryFullname turns a repository name into owner/name.
+// The owner is the organization if one is set, the user otherwise, known once Authenticate succeeded. owner/name is returned as is
+func (self *GithubPrivacyManager) RepositoryFullname(repositoryName string) string {
 
-	if err != nil {
-		return err
+	if strings.Contains(repositoryName, "/") {
+		return repositoryName
 	}
 
-	fmt.Printf("your private repositories : %s \n", names)
+	if self.organization != "" {
+		return fmt.Sprintf("%s/%s", self.organization, repositoryName)
+	}
 
-	return nil
+	return fmt.Sprintf("%s/%s", self.username, repositoryName)
+}
+
+// repositoriesPath returns the listing endpoint of the organization, or of the repositories the user owns.
+// visibility is all, public, private, or internal for organizations only
+func (self *GithubPrivacyManager) repositoriesPath(visibility string) string {
+
+	if self.organization != "" {
+		return fmt.Sprintf("/orgs/%s/repos?type=%s", url.PathEscape(self.organization), visibility)
+	}
 
+	return fmt.Sprintf("/user/repos?visibility=%s&affiliation=owner", visibility)
 }
 
-func (self *GithubPrivacyManager) SwitchRepoToPrivateByName(ctx context.Context, repositoryName string) error {
+// ownedRepositories iterates over the repositories of the organization, or the ones the user owns. visibility as in repositoriesPath.
+// A GitHub App installed on a user account lists the repositories it was given access to instead, filtered here
+func (self *GithubPrivacyManager) ownedRepositories(ctx context.Context, visibility string) iter.Seq2[GithubRepository, error] {
+	return func(yield func(GithubRepository, error) bool) {
 
-	readmeRepository := fmt.Sprintf("%s/%s", self.username, self.username)
+		if err := self.Authenticate(ctx); err != nil {
+			yield(GithubRepository{}, err)
+			return
+		}
 
-	targetRepository := fmt.Sprintf("%s/%s", self.username, repositoryName)
+		if !self.userInstallation || self.organization != "" {
 
-	if targetRepository == readmeRepository {
-		return fmt.Errorf("it makes no sense to make private your %s.\nGo through the web ui for that", readmeRepository)
-	}
+			for repo, err := range self.Repositories(ctx, self.repositoriesPath(visibility)) {
+				if !yield(repo, err) {
+					return
+				}
+			}
 
-	publicRepoEndpoint := fmt.Sprintf("https://api.github.com/repos/%s", targetRepository)
+			return
+		}
 
-	httpRequest, _ := http.NewRequestWithContext(ctx, http.MethodGet, publicRepoEndpoint, http.NoBody)
+		for repo, err := range self.Repositories(ctx, "/installation/repositories") {
 
-	self.setRequiredHeadersOnGithubRequest(httpRequest)
+			if err != nil {
+				yield(GithubRepository{}, err)
+				return
+			}
 
-	httpReponse, err := self.httpClient.Do(httpRequest)
+			if visibility != "all" && VisibilityOf(repo) != Visibility(visibility) {
+				continue
+			}
 
-	if err != nil {
-		return err
+			if !yield(repo, nil) {
+				return
+			}
+		}
 	}
+}
 
-	var publicRepository GithubRepository
+// SetJournal records every visibility change made from now on into journal
+func (self *GithubPrivacyManager) SetJournal(journal *Journal) {
+	self.journal = journal
+}
 
-	if err := json.NewDecoder(httpReponse.Body).Decode(&publicRepository); err != nil {
-		return err
+func (self *GithubPrivacyManager) setRequiredHeadersOnGithubRequest(httpRequest *http.Request) {
+
+	// Authorization is set by the authTransport of httpClient, from the tokenSource
+
+	// Recommended in the github API documentation
+	httpRequest.Header.Set("Accept", "application/vnd.github+json")
+
+	// Recommended in the github API documentation
+	httpRequest.Header.Set("User-Agent", "ghpm")
+
+	// Targeted Github API version
+	httpRequest.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+}
+
+// ListAllPublicRepositories lists the same repositories as thanos_snap: the ones of the organization, or the ones the user owns
+func (self *GithubPrivacyManager) ListAllPublicRepositories(ctx context.Context) ([]GithubRepository, error) {
+	return CollectRepositories(self.ownedRepositories(ctx, "public"))
+}
+
+// ListAllInternalRepositories : github can't filter user listings by internal, so they are filtered here
+func (self *GithubPrivacyManager) ListAllInternalRepositories(ctx context.Context) ([]GithubRepository, error) {
+
+	visibility := "all"
+
+	if self.organization != "" {
+		visibility = "internal"
 	}
 
-	if publicRepository.Stars >= STARS_THRESHOLD {
-		return fmt.Errorf("repository cannot be switched to private by ghpm because it has more than %d ", STARS_THRESHOLD)
+	var internalRepositories []GithubRepository
+
+	for repo, err := range self.ownedRepositories(ctx, visibility) {
+
+		if err != nil {
+			return nil, err
+		}
+
+		if VisibilityOf(repo) == VisibilityInternal {
+			internalRepositories = append(internalRepositories, repo)
+		}
 	}
 
-	payload := map[string]any{
-		"private": true,
+	return internalRepositories, nil
+}
+
+func (self *GithubPrivacyManager) ListAllPrivateRepositories(ctx context.Context) ([]GithubRepository, error) {
+	return CollectRepositories(self.ownedRepositories(ctx, "private"))
+}
+
+// SwitchRepositoryByName fetches then switches one repository, and reports how it went instead of failing.
+// It accepts a bare name (see RepositoryFullname) or owner/name. Taking a repository out of public goes through the skip policy
+func (self *GithubPrivacyManager) SwitchRepositoryByName(ctx context.Context, repositoryName string, targetVisibility Visibility) SwitchResult {
+
+	if err := self.Authenticate(ctx); err != nil {
+		return failedResult(GithubRepository{Fullname: repositoryName}, err)
 	}
 
-	jsonPayload, err := json.Marshal(payload)
+	plannedResult := self.planRepositoryByName(ctx, repositoryName, targetVisibility)
 
-	if err != nil {
-		return err
+	if plannedResult.Outcome != OutcomePlanned {
+		return plannedResult
 	}
 
-	httpPatchRequest, _ := http.NewRequestWithContext(ctx, http.MethodPatch, publicRepoEndpoint, bytes.NewBuffer(jsonPayload))
+	return self.switchRepositoryVisibility(ctx, plannedResult.Repository, targetVisibility)
+}
 
-	self.setRequiredHeadersOnGithubRequest(httpPatchRequest)
+// planRepositoryByName fetches one repository, and tells whether it would be switched
+func (self *GithubPrivacyManager) planRepositoryByName(ctx context.Context, repositoryName string, targetVisibility Visibility) SwitchResult {
 
-	httpResponse, err := self.httpClient.Do(httpPatchRequest)
+	targetRepository := self.RepositoryFullname(repositoryName)
+
+	repository, err := self.getRepository(ctx, targetRepository)
 
 	if err != nil {
-		return err
+		return failedResult(GithubRepository{Fullname: targetRepository}, err)
 	}
 
-	defer httpResponse.Body.Close()
+	return self.PlanRepositoriesVisibility([]GithubRepository{repository}, targetVisibility)[0]
+}
 
-	switch {
-	case httpResponse.StatusCode == http.StatusUnprocessableEntity:
+// SwitchRepositoriesByName is SwitchRepositoryByName for many names, concurrently, see SetConcurrency.
+// Every repository is fetched before any is switched, so the ones the token can't change are known up front. Returns one result per name, in order
+func (self *GithubPrivacyManager) SwitchRepositoriesByName(ctx context.Context, repositoryNames []string, targetVisibility Visibility) []SwitchResult {
+
+	results := make([]SwitchResult, len(repositoryNames))
 
-		return fmt.Errorf("repository %s was not switched to private. Consider using the web ui for this one", repositoryName)
+	if err := self.Authenticate(ctx); err != nil {
 
-	case httpResponse.StatusCode == http.StatusNotFound:
+		for index, repositoryName := range repositoryNames {
+			results[index] = failedResult(GithubRepository{Fullname: repositoryName}, err)
+		}
 
-		return fmt.Errorf("repository %s was not switched to private because it was not found. Did you misspell?", repositoryName)
+		return results
 	}
 
-	return nil
+	// each worker only writes at the index it works on, no lock needed
+	self.forEachConcurrently(len(repositoryNames), func(index int) {
+		results[index] = self.planRepositoryByName(ctx, repositoryNames[index], targetVisibility)
+	})
 
+	self.switchPlannedResults(ctx, results, targetVisibility)
+
+	return results
 }
 
-func (self *GithubPrivacyManager) SwitchRepoToPublicByName(ctx context.Context, repositoryName string) error {
+// SwitchRepoVisibilityByName is SwitchRepositoryByName, for callers that only care whether the repository
+// ends up with targetVisibility. A repository that already has it is not an error.
+// The error wraps the one of the result: an *APIError, or ErrProtectedRepository when ghpm left it as is on purpose
+func (self *GithubPrivacyManager) SwitchRepoVisibilityByName(ctx context.Context, repositoryName string, targetVisibility Visibility) error {
 
-	readmeRepository := fmt.Sprintf("%s/%s", self.username, self.username)
+	result := self.SwitchRepositoryByName(ctx, repositoryName, targetVisibility)
 
-	targetRepository := fmt.Sprintf("%s/%s", self.username, repositoryName)
+	switch {
+	case result.Outcome == OutcomeFailed:
 
-	if targetRepository == readmeRepository {
+		return fmt.Errorf("repository %s was not switched to %s: %w", repositoryName, targetVisibility, result.Err)
 
-		return fmt.Errorf("it makes no sense to change your %s. It's your profile's README: it's meant to be read.\nGo through the web ui for that", readmeRepository)
+	case result.Outcome == OutcomeSkipped && result.Err != nil:
 
+		return fmt.Errorf("repository %s cannot be switched to %s by ghpm: %w", repositoryName, targetVisibility, result.Err)
 	}
 
-	privateRepositoryEndpoint := fmt.Sprintf("https://api.github.com/repos/%s", targetRepository)
+	return nil
 
-	payload := map[string]any{
-		"private": false,
-	}
+}
 
-	jsonPayload, err := json.Marshal(payload)
+// SwitchRepoToPrivateByName accepts a bare name (see RepositoryFullname) or owner/name
+func (self *GithubPrivacyManager) SwitchRepoToPrivateByName(ctx context.Context, repositoryName string) error {
+	return self.SwitchRepoVisibilityByName(ctx, repositoryName, VisibilityPrivate)
+}
 
-	if err != nil {
-		return err
-	}
+// SwitchRepoToPublicByName accepts a bare name (see RepositoryFullname) or owner/name
+func (self *GithubPrivacyManager) SwitchRepoToPublicByName(ctx context.Context, repositoryName string) error {
+	return self.SwitchRepoVisibilityByName(ctx, repositoryName, VisibilityPublic)
+}
 
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPatch, privateRepositoryEndpoint, bytes.NewBuffer(jsonPayload))
+// SwitchRepoToInternalByName accepts a bare name (see RepositoryFullname) or owner/name.
+// Only repositories of organizations owned by an enterprise can be internal
+func (self *GithubPrivacyManager) SwitchRepoToInternalByName(ctx context.Context, repositoryName string) error {
+	return self.SwitchRepoVisibilityByName(ctx, repositoryName, VisibilityInternal)
+}
 
-	if err != nil {
-		return err
-	}
+// skipReasonFor tells why ghpm refuses to switch repo to targetVisibility, whichever path the repository came from:
+// by name, by selection, from a file, a plan or a policy. Empty when it does not refuse
+func (self *GithubPrivacyManager) skipReasonFor(repo GithubRepository, targetVisibility Visibility) string {
 
-	self.setRequiredHeadersOnGithubRequest(httpRequest)
+	if targetVisibility == VisibilityPublic {
+		return self.skipReasonToGoPublic(repo)
+	}
 
-	httpResponse, err := self.httpClient.Do(httpRequest)
+	return self.skipReasonToLeavePublic(repo)
+}
 
-	if err != nil {
+// skipReasonToGoPublic tells why ghpm refuses to switch repo to public. Empty when it does not refuse
+func (self *GithubPrivacyManager) skipReasonToGoPublic(repo GithubRepository) string {
 
-		log.Printf("%s was not switched to private. I suggest to you try from the web version for this one. I am sorry for failing you, please complain to the developer", targetRepository)
+	readmeRepository := fmt.Sprintf("%s/%s", self.username, self.username)
 
-		return err
+	if !self.skipPolicy.AllowReadmeRepository && strings.EqualFold(repo.Fullname, readmeRepository) {
+		return "it makes no sense to change your profile's README: it's meant to be read. Go through the web ui for that"
 	}
 
-	defer httpResponse.Body.Close()
-
-	switch {
-	case httpResponse.StatusCode == http.StatusUnprocessableEntity:
+	return ""
+}
 
-		return fmt.Errorf("repository %s was not switched to public. Consider using the web ui for this one", repositoryName)
+// skipReasonToLeavePublic tells why ghpm refuses to switch repo to private or internal.
+// Empty when it does not refuse. A repository that is not public has nothing left to lose
+func (self *GithubPrivacyManager) skipReasonToLeavePublic(repo GithubRepository) string {
 
-	case httpResponse.StatusCode == http.StatusNotFound:
+	if VisibilityOf(repo) != VisibilityPublic {
+		return ""
+	}
 
-		return fmt.Errorf("repository %s was not switched to public because it was not found. Did you misspell?", repositoryName)
+	return self.skipPolicy.SkipReason(repo, self.username)
+}
 
-	case httpResponse.StatusCode >= 500:
+// PlanAllRepositoriesToPrivate returns what SwitchAllRepositoriesToPrivate would do, without changing anything:
+// one result per public repository, in listing order, either planned, skipped with the reason why,
+// or failed when the token can't change it
+func (self *GithubPrivacyManager) PlanAllRepositoriesToPrivate(ctx context.Context) ([]SwitchResult, error) {
 
-		return fmt.Errorf("github is likely down. Retry. If it does persist: Please complain to the developer")
+	if err := self.Authenticate(ctx); err != nil {
+		return nil, err
 	}
 
-	return nil
+	publicRepositories, err := CollectRepositories(self.ownedRepositories(ctx, "public"))
 
-}
+	if err != nil {
+		return nil, err
+	}
 
-func (self *GithubPrivacyManager) SwitchAllRepositoriesToPrivate(ctx context.Context) error {
+	results := self.PlanRepositoriesVisibility(publicRepositories, VisibilityPrivate)
 
-	publicRepositoriesGithubAPIEndpoint := fmt.Sprintf("https://api.github.com/users/%s/repos?visibility=public&per_page=100", self.username)
+	// a dry run tells which repositories would fail too
+	self.preflight(results)
 
-	readmeRepository := fmt.Sprintf("%s/%s", self.username, self.username)
+	return results, nil
+}
 
-	for {
+// SwitchAllRepositoriesToPrivate returns one result per public repository, in listing order
+func (self *GithubPrivacyManager) SwitchAllRepositoriesToPrivate(ctx context.Context) ([]SwitchResult, error) {
 
-		publicRepositoriesHTTPRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, publicRepositoriesGithubAPIEndpoint, http.NoBody)
+	// snapshot every candidate first, then act on that fixed set.
+	// Listing while switching would shift the pages under our feet as repositories leave the public listing
+	results, err := self.PlanAllRepositoriesToPrivate(ctx)
 
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		self.setRequiredHeadersOnGithubRequest(publicRepositoriesHTTPRequest)
+	self.switchPlannedResults(ctx, results, VisibilityPrivate)
 
-		httpResponse, err := self.httpClient.Do(publicRepositoriesHTTPRequest)
+	return results, nil
 
-		if err != nil {
-			return err
-		}
+}
 
-		switch {
-		case httpResponse.StatusCode == http.StatusNotFound:
+// PlanRepositoriesVisibility returns what SwitchRepositoriesVisibility would do, without changing anything.
+// The skip policy needs the username: call Authenticate first on a lazy manager
+func (self *GithubPrivacyManager) PlanRepositoriesVisibility(repositories []GithubRepository, targetVisibility Visibility) []SwitchResult {
 
-			return fmt.Errorf("%d : not found. Did you spell that right? that its name?", http.StatusNotFound)
+	plan := make([]SwitchResult, 0, len(repositories))
 
-		case httpResponse.StatusCode >= 500:
+	for _, repo := range repositories {
 
-			return fmt.Errorf("github is likely down. Retry. If it does persist: Please complain to the developer")
-		}
+		if VisibilityOf(repo) == targetVisibility {
 
-		var publicRepositories []GithubRepository
+			plan = append(plan, SwitchResult{Repository: repo, Outcome: OutcomeSkipped, Reason: fmt.Sprintf("already %s", targetVisibility)})
 
-		if err := json.NewDecoder(httpResponse.Body).Decode(&publicRepositories); err != nil {
-			return err
+			continue
 		}
 
-		httpResponse.Body.Close()
-
-		payload := map[string]any{
-			"private": true,
-		}
+		if reason := self.skipReasonFor(repo, targetVisibility); reason != "" {
 
-		jsonPayload, err := json.Marshal(payload)
+			plan = append(plan, protectedResult(repo, reason))
 
-		if err != nil {
-			return fmt.Errorf("json.Marshal: %s", err)
+			continue
 		}
 
-		var switchWaitGroup sync.WaitGroup
+		plan = append(plan, SwitchResult{Repository: repo, Outcome: OutcomePlanned})
+	}
 
-		// TODO : lobby github for a batch request endpoint, so that it can be only 1 HTTP call and not O(n) HTTP calls
-		for _, repo := range publicRepositories {
+	return plan
+}
 
-			if repo.Fullname == readmeRepository {
+// SwitchRepositoriesVisibility switches repositories concurrently. Returns one result per repository, in order
+func (self *GithubPrivacyManager) SwitchRepositoriesVisibility(ctx context.Context, repositories []GithubRepository, targetVisibility Visibility) []SwitchResult {
 
-				fmt.Printf("skipped %s because it's a special repository \n", readmeRepository)
+	if err := self.Authenticate(ctx); err != nil {
 
-				continue
-			}
+		results := make([]SwitchResult, 0, len(repositories))
 
-			if repo.Stars >= STARS_THRESHOLD {
+		for _, repo := range repositories {
+			results = append(results, failedResult(repo, err))
+		}
 
-				log.Printf("repository %s cannot be switched to private by ghpm because it has more than %d stars -> (%d) \n", repo.Fullname, STARS_THRESHOLD, repo.Stars)
+		return results
+	}
 
-				continue
-			}
+	results := self.PlanRepositoriesVisibility(repositories, targetVisibility)
 
-			if repo.IsFork {
+	self.switchPlannedResults(ctx, results, targetVisibility)
 
-				log.Printf("skipped %s because it's a fork \n", repo.Fullname)
+	return results
+}
 
-				continue
-			}
+// switchPlannedResults switches the planned results concurrently, see SetConcurrency, and replaces them with how it went.
+// The ones the token can't change fail before anything changes, see preflight
+func (self *GithubPrivacyManager) switchPlannedResults(ctx context.Context, results []SwitchResult, targetVisibility Visibility) {
+	self.switchPlannedResultsTo(ctx, results, func(int) Visibility { return targetVisibility })
+}
 
-			switchWaitGroup.Add(1)
+// switchPlannedResultsTo is switchPlannedResults with a target visibility per result
+func (self *GithubPrivacyManager) switchPlannedResultsTo(ctx context.Context, results []SwitchResult, targetVisibilityOf func(index int) Visibility) {
 
-			go func() {
+	self.preflight(results)
 
-				defer switchWaitGroup.Done()
+	var plannedIndexes []int
 
-				currentPublicRepositoryEndpoint := fmt.Sprintf("https://api.github.com/repos/%s", repo.Fullname)
+	for index, plannedResult := range results {
+		if plannedResult.Outcome == OutcomePlanned {
+			plannedIndexes = append(plannedIndexes, index)
+		}
+	}
 
-				httpPatchRequest, err := http.NewRequestWithContext(ctx, http.MethodPatch, currentPublicRepositoryEndpoint, bytes.NewBuffer(jsonPayload))
+	// TODO : lobby github for a batch request endpoint, so that it can be only 1 HTTP call and not O(n) HTTP calls
+	// each worker only writes at the index it works on, no lock needed
+	self.forEachConcurrently(len(plannedIndexes), func(plannedIndex int) {
 
-				if err != nil {
+		index := plannedIndexes[plannedIndex]
 
-					log.Printf("error requesting %s: %s \n", repo.Fullname, err)
-					log.Println("skipping", repo.Fullname)
+		results[index] = self.switchRepositoryVisibility(ctx, results[index].Repository, targetVisibilityOf(index))
+	})
+}
 
-					switchWaitGroup.Done()
+// switchRepositoryVisibility sends the PATCH request for one repository and reports how it went
+func (self *GithubPrivacyManager) switchRepositoryVisibility(ctx context.Context, repo GithubRepository, targetVisibility Visibility) SwitchResult {
 
-					return
-				}
+	if reason := self.cannotChangeReason(repo); reason != "" {
+		return failedResult(repo, fmt.Errorf("%s: %w", reason, ErrForbidden))
+	}
 
-				self.setRequiredHeadersOnGithubRequest(httpPatchRequest)
+	payload := map[string]any{
+		"visibility": targetVisibility,
+	}
 
-				httpResponse, err := self.httpClient.Do(httpPatchRequest)
+	jsonPayload, err := json.Marshal(payload)
 
-				if err != nil {
+	if err != nil {
+		return failedResult(repo, fmt.Errorf("json.Marshal: %w", err))
+	}
 
-					log.Printf("error processing %s; err=%s", repo.Fullname, err)
+	repositoryEndpoint := fmt.Sprintf("%s/repos/%s", self.apiBaseURL, repo.Fullname)
 
-					switchWaitGroup.Done()
+	httpPatchRequest, err := http.NewRequestWithContext(ctx, http.MethodPatch, repositoryEndpoint, bytes.NewBuffer(jsonPayload))
 
-					return
-				}
+	if err != nil {
+		return failedResult(repo, err)
+	}
 
-				httpResponse.Body.Close()
+	// setting the same visibility twice is harmless, the request can be retried
+	httpPatchRequest = markIdempotent(httpPatchRequest)
 
-				switch {
-				case httpResponse.StatusCode == http.StatusNotImplemented:
+	self.setRequiredHeadersOnGithubRequest(httpPatchRequest)
 
-					log.Printf("%s was not switched to private. I suggest to you try from the web version for this one. I am sorry for failing you, please complain to the developer \n", repo.Fullname)
+	httpResponse, err := self.httpClient.Do(httpPatchRequest)
 
-				case httpResponse.StatusCode == http.StatusNotFound:
+	if err != nil {
+		return failedResult(repo, err)
+	}
 
-					log.Printf("%s was not found. Did you spell that right? that its name? \n", repo.Fullname)
+	defer httpResponse.Body.Close()
 
-				case httpResponse.StatusCode >= 500:
+	if httpResponse.StatusCode >= 300 {
 
-					log.Printf("github is likely down. Retry. If it does persist: Please complain to the developer. %s not switched \n", repo.Fullname)
+		apiError := newAPIError(httpResponse)
 
-				default:
+		switch {
+		case apiError.Status == http.StatusUnprocessableEntity:
 
-					log.Printf("%s switched to private. \n", repo.Fullname)
-				}
+			return SwitchResult{Repository: repo, Outcome: OutcomeFailed, Reason: fmt.Sprintf("github refused: %s. Consider using the web ui for this one", apiError.Message), Err: apiError}
 
-			}()
+		case apiError.Status >= 500:
 
+			return SwitchResult{Repository: repo, Outcome: OutcomeFailed, Reason: fmt.Sprintf("github is likely down, still %s after retrying. Retry later", httpResponse.Status), Err: apiError}
 		}
 
-		switchWaitGroup.Wait()
+		return failedResult(repo, apiError)
+	}
 
-		if len(publicRepositories) != 100 {
-			break
-		}
+	if previousVisibility := VisibilityOf(repo); previousVisibility != targetVisibility && self.journal != nil {
 
+		err := self.journal.Record(JournalEntry{
+			APIBaseURL: self.apiBaseURL,
+			Username:   self.username,
+			Repository: repo.Fullname,
+			From:       previousVisibility,
+			To:         targetVisibility,
+		})
+
+		if err != nil {
+			log.Printf("%s was switched to %s but could not be written to the journal, ghpm undo won't know about it: %s \n", repo.Fullname, targetVisibility, err)
+		}
 	}
 
-	return nil
+	// internal repositories are private to the rest of the world
+	repo.Private = targetVisibility != VisibilityPublic
+	repo.Visibility = string(targetVisibility)
 
+	return SwitchResult{Repository: repo, Outcome: OutcomeSwitched}
 }
@@ -0,0 +1,451 @@
+package ghpm_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/Neal-C/ghpm/internal/ghpmtest"
+)
+
+func newTestManager(t *testing.T) (*ghpmtest.Server, *ghpm.GithubPrivacyManager) {
+
+	server := ghpmtest.NewServer(t)
+
+	return server, ghpm.NewLazyGithubPrivacyManager(server.URL, ghpm.StaticToken(server.Token()), server.Client())
+}
+
+func TestSwitchRepositoryByName(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	result := manager.SwitchRepositoryByName(context.Background(), "hello", ghpm.VisibilityPrivate)
+
+	if result.Outcome != ghpm.OutcomeSwitched {
+		t.Fatalf("outcome = %s (%s), want switched", result.Outcome, result.Reason)
+	}
+
+	if repo, _ := server.Repository("octocat/hello"); repo.Visibility != "private" || !repo.Private {
+		t.Errorf("server has %s/private=%t, want private", repo.Visibility, repo.Private)
+	}
+}
+
+func TestSwitchRepositoryByNameSkipsStarredRepositories(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "famous", Stars: 100})
+
+	err := manager.SwitchRepoVisibilityByName(context.Background(), "famous", ghpm.VisibilityPrivate)
+
+	var protected ghpm.ErrProtectedRepository
+
+	if !errors.As(err, &protected) {
+		t.Fatalf("err = %v, want ErrProtectedRepository", err)
+	}
+
+	if slices.Contains(server.Requests(), "PATCH /repos/octocat/famous") {
+		t.Error("a protected repository was sent a PATCH")
+	}
+}
+
+func TestSelectedReadmeRepositoryIsNotSwitchedToPublic(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "octocat", Private: true})
+
+	selector, err := ghpm.NewRepositorySelector(nil, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repositories, err := manager.SelectRepositories(context.Background(), []string{"octocat"}, selector)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := manager.SwitchRepositoriesVisibility(context.Background(), repositories, ghpm.VisibilityPublic)
+
+	var protected ghpm.ErrProtectedRepository
+
+	if len(results) != 1 || results[0].Outcome != ghpm.OutcomeSkipped || !errors.As(results[0].Err, &protected) {
+		t.Fatalf("results = %+v, want the profile README skipped", results)
+	}
+
+	if repo, _ := server.Repository("octocat/octocat"); repo.Visibility != "private" {
+		t.Errorf("server has %s, want private", repo.Visibility)
+	}
+}
+
+func TestSwitchRepositoryByNameNotFound(t *testing.T) {
+
+	_, manager := newTestManager(t)
+
+	err := manager.SwitchRepoVisibilityByName(context.Background(), "missing", ghpm.VisibilityPrivate)
+
+	var apiError *ghpm.APIError
+
+	if !errors.Is(err, ghpm.ErrNotFound) || !errors.As(err, &apiError) || apiError.Status != http.StatusNotFound {
+		t.Fatalf("err = %v, want a 404 *APIError", err)
+	}
+}
+
+func TestSwitchRepositoryByNameUnprocessable(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	server.InjectFault(http.MethodPatch, "/repos/octocat/hello", ghpmtest.Fault{Status: http.StatusUnprocessableEntity, Message: "Validation Failed"})
+
+	result := manager.SwitchRepositoryByName(context.Background(), "hello", ghpm.VisibilityPrivate)
+
+	var apiError *ghpm.APIError
+
+	if result.Outcome != ghpm.OutcomeFailed || !errors.As(result.Err, &apiError) || apiError.Message != "Validation Failed" {
+		t.Fatalf("result = %s %v, want failed with the message of github", result.Outcome, result.Err)
+	}
+}
+
+func TestListAllPublicRepositoriesFollowsPages(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.SetPerPage(2)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		server.AddRepository(ghpm.GithubRepository{Name: name})
+	}
+
+	server.AddRepository(ghpm.GithubRepository{Name: "secret", Private: true})
+
+	repositories, err := manager.ListAllPublicRepositories(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := slices.Collect(ghpm.ToFullname(repositories)); !slices.Equal(got, []string{"octocat/a", "octocat/b", "octocat/c", "octocat/d", "octocat/e"}) {
+		t.Errorf("listed %v", got)
+	}
+}
+
+func TestListingsOnlyListOwnedRepositories(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Name: "secret", Private: true})
+	server.AddRepository(ghpm.GithubRepository{Fullname: "octo-org/site"})
+	server.AddRepository(ghpm.GithubRepository{Fullname: "octo-org/vault", Private: true})
+
+	public, err := manager.ListAllPublicRepositories(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private, err := manager.ListAllPrivateRepositories(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the repositories thanos_snap acts on, not the ones the user collaborates on
+	listed := slices.Concat(slices.Collect(ghpm.ToFullname(public)), slices.Collect(ghpm.ToFullname(private)))
+
+	if !slices.Equal(listed, []string{"octocat/hello", "octocat/secret"}) {
+		t.Errorf("listed %v", listed)
+	}
+}
+
+func TestSwitchRetriesServerErrors(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	server.InjectFault(http.MethodPatch, "/repos/octocat/hello", ghpmtest.Fault{Status: http.StatusBadGateway})
+
+	result := manager.SwitchRepositoryByName(context.Background(), "hello", ghpm.VisibilityPrivate)
+
+	if result.Outcome != ghpm.OutcomeSwitched {
+		t.Fatalf("outcome = %s (%s), want switched after a retry", result.Outcome, result.Reason)
+	}
+}
+
+func TestSwitchDoesNotRetryWithOneAttempt(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	manager.SetMaxAttempts(1)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	server.InjectFault(http.MethodPatch, "/repos/octocat/hello", ghpmtest.Fault{Status: http.StatusBadGateway})
+
+	result := manager.SwitchRepositoryByName(context.Background(), "hello", ghpm.VisibilityPrivate)
+
+	if result.Outcome != ghpm.OutcomeFailed {
+		t.Fatalf("outcome = %s, want failed", result.Outcome)
+	}
+}
+
+func TestSwitchWaitsForRetryAfter(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	server.InjectFault(http.MethodPatch, "/repos/octocat/hello", ghpmtest.Fault{
+		Status:  http.StatusForbidden,
+		Message: "You have exceeded a secondary rate limit",
+		Header:  http.Header{"Retry-After": {"0"}},
+		Times:   2,
+	})
+
+	result := manager.SwitchRepositoryByName(context.Background(), "hello", ghpm.VisibilityPrivate)
+
+	if result.Outcome != ghpm.OutcomeSwitched {
+		t.Fatalf("outcome = %s (%s), want switched once the rate limit is over", result.Outcome, result.Reason)
+	}
+}
+
+func TestListingWaitsForRetryAfterWithoutRetries(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	// waiting out a rate limit is not a retry
+	manager.SetMaxAttempts(1)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	server.InjectFault(http.MethodGet, "/user/repos", ghpmtest.Fault{
+		Status:  http.StatusForbidden,
+		Message: "You have exceeded a secondary rate limit",
+		Header:  http.Header{"Retry-After": {"0"}},
+		Times:   2,
+	})
+
+	repositories, err := manager.ListAllPublicRepositories(context.Background())
+
+	if err != nil || len(repositories) != 1 {
+		t.Fatalf("got %d repositories, err = %v, want the listing once the rate limit is over", len(repositories), err)
+	}
+}
+
+func TestRateLimitedRequestIsSentAtMostMaxSendsTimes(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	server.InjectFault(http.MethodGet, "/repos/octocat/hello", ghpmtest.Fault{
+		Status: http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": {"0"}},
+		Times:  100,
+	})
+
+	result := manager.SwitchRepositoryByName(context.Background(), "hello", ghpm.VisibilityPrivate)
+
+	if result.Outcome != ghpm.OutcomeFailed || !errors.Is(result.Err, ghpm.ErrRateLimited) {
+		t.Fatalf("outcome = %s (%v), want failed, rate limited", result.Outcome, result.Err)
+	}
+
+	sends := 0
+
+	for _, request := range server.Requests() {
+		if request == "GET /repos/octocat/hello" {
+			sends++
+		}
+	}
+
+	if sends != ghpm.MAX_SENDS_PER_REQUEST {
+		t.Errorf("sent %d times, want %d: retries and rate limit replays must not multiply", sends, ghpm.MAX_SENDS_PER_REQUEST)
+	}
+}
+
+func TestSwitchAllRepositoriesToPrivate(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	manager.SetConcurrency(2)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		server.AddRepository(ghpm.GithubRepository{Name: name})
+	}
+
+	server.AddRepository(ghpm.GithubRepository{Name: "fork", IsFork: true})
+
+	server.AddRepository(ghpm.GithubRepository{Name: "archived", Archived: true})
+
+	results, err := manager.SwitchAllRepositoriesToPrivate(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := ghpm.NewSwitchSummary(results)
+
+	if len(summary.Switched) != 4 || len(summary.Skipped) != 1 || len(summary.Failed) != 1 {
+		t.Fatalf("switched %d, skipped %d, failed %d, want 4, 1, 1", len(summary.Switched), len(summary.Skipped), len(summary.Failed))
+	}
+
+	if summary.Status() != ghpm.SummaryStatusPartialFailure {
+		t.Errorf("status = %s, want partial_failure", summary.Status())
+	}
+}
+
+func TestNewGithubPrivacyManager(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	manager, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, ghpm.StaticToken(server.Token()), server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manager.Username() != ghpmtest.USERNAME {
+		t.Errorf("username = %q, want %q", manager.Username(), ghpmtest.USERNAME)
+	}
+
+	if scopes, known := manager.Scopes(); !known || !slices.Equal(scopes, []string{"repo"}) {
+		t.Errorf("scopes = %v %t, want [repo] true", scopes, known)
+	}
+}
+
+func TestNewGithubPrivacyManagerRejectedToken(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	_, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, ghpm.StaticToken("not-the-token"), server.Client())
+
+	if !errors.Is(err, ghpm.ErrUnauthorized) {
+		t.Fatalf("err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestNewGithubPrivacyManagerMissingScope(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.SetScopes([]string{"read:user"})
+
+	_, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, ghpm.StaticToken(server.Token()), server.Client())
+
+	var missingScopes ghpm.ErrMissingScopes
+
+	if !errors.As(err, &missingScopes) || !slices.Equal(missingScopes.Missing, []string{"repo"}) {
+		t.Fatalf("err = %v, want the repo scope missing", err)
+	}
+}
+
+func TestNewGithubPrivacyManagerFineGrainedToken(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.SetScopes(nil)
+
+	manager, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, ghpm.StaticToken(server.Token()), server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, known := manager.Scopes(); known {
+		t.Error("scopes are known without X-OAuth-Scopes")
+	}
+}
+
+func TestLazyGithubPrivacyManagerAuthenticatesOnce(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	if len(server.Requests()) != 0 {
+		t.Fatalf("the lazy constructor requested github: %v", server.Requests())
+	}
+
+	server.AddRepository(ghpm.GithubRepository{Name: "a"})
+	server.AddRepository(ghpm.GithubRepository{Name: "b"})
+
+	manager.SwitchRepositoriesByName(context.Background(), []string{"a", "b"}, ghpm.VisibilityPrivate)
+
+	userRequests := 0
+
+	for _, request := range server.Requests() {
+		if request == "GET /user" {
+			userRequests++
+		}
+	}
+
+	if userRequests != 1 {
+		t.Errorf("GET /user was requested %d times, want 1", userRequests)
+	}
+}
+
+func TestAuthenticateRefusesTheTokenOfAnotherUser(t *testing.T) {
+
+	_, manager := newTestManager(t)
+
+	manager.SetUsername("hubot")
+
+	if err := manager.Authenticate(context.Background()); err == nil {
+		t.Error("the token of octocat was accepted for hubot")
+	}
+}
+
+func TestPreflightRefusesRepositoriesUpFront(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Fullname: "some-org/not-mine"})
+	server.AddRepository(ghpm.GithubRepository{Name: "archived", Archived: true})
+
+	var refused []string
+
+	manager.SetPreflightReport(func(results []ghpm.SwitchResult) {
+
+		if slices.Contains(server.Requests(), "PATCH /repos/octocat/hello") {
+			t.Error("reported after a repository was switched")
+		}
+
+		refused = slices.Collect(ghpm.ToFullname(repositoriesOf(results)))
+	})
+
+	results := manager.SwitchRepositoriesByName(context.Background(), []string{"hello", "some-org/not-mine", "archived"}, ghpm.VisibilityPrivate)
+
+	if !slices.Equal(refused, []string{"some-org/not-mine", "octocat/archived"}) {
+		t.Errorf("refused %v", refused)
+	}
+
+	if results[0].Outcome != ghpm.OutcomeSwitched || !errors.Is(results[1].Err, ghpm.ErrForbidden) || !errors.Is(results[2].Err, ghpm.ErrForbidden) {
+		t.Errorf("results %v", results)
+	}
+
+	for _, request := range server.Requests() {
+		if request == "PATCH /repos/some-org/not-mine" || request == "PATCH /repos/octocat/archived" {
+			t.Errorf("%s was sent", request)
+		}
+	}
+}
+
+func repositoriesOf(results []ghpm.SwitchResult) []ghpm.GithubRepository {
+
+	repositories := make([]ghpm.GithubRepository, 0, len(results))
+
+	for _, result := range results {
+		repositories = append(repositories, result.Repository)
+	}
+
+	return repositories
+}
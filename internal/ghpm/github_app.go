@@ -0,0 +1,194 @@
+package ghpm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// REFRESH_BEFORE_EXPIRY : installation tokens live an hour, a new one is requested when the current one has less than this left
+const REFRESH_BEFORE_EXPIRY = 5 * time.Minute
+
+// AppInstallationTokenSource acts as an installation of a GitHub App: it signs a JWT with the private key of the app,
+// exchanges it for an installation token, and exchanges again shortly before the token expires.
+// The installation needs the Administration (read and write) and Metadata (read) repository permissions
+type AppInstallationTokenSource struct {
+	// the App ID, or the Client ID, of the GitHub App
+	AppID string
+
+	InstallationID int64
+
+	PrivateKey *rsa.PrivateKey
+
+	// root of the REST API, see APIBaseURL
+	APIBaseURL string
+
+	// http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	mutex sync.Mutex
+
+	token string
+
+	expiresAt time.Time
+}
+
+// InstallationAccount : who installed the app, an organization most often
+type InstallationAccount struct {
+	Login string `json:"login"`
+
+	// User or Organization
+	Type string `json:"type"`
+}
+
+func (self *AppInstallationTokenSource) Token(ctx context.Context) (string, error) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	if self.token != "" && time.Until(self.expiresAt) > REFRESH_BEFORE_EXPIRY {
+		return self.token, nil
+	}
+
+	var installationToken struct {
+		Token string `json:"token"`
+
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	if err := self.requestAsApp(ctx, http.MethodPost, fmt.Sprintf("/app/installations/%d/access_tokens", self.InstallationID), &installationToken); err != nil {
+		return "", fmt.Errorf("could not get a token for the installation %d of the app %s: %w", self.InstallationID, self.AppID, err)
+	}
+
+	self.token = installationToken.Token
+	self.expiresAt = installationToken.ExpiresAt
+
+	return self.token, nil
+}
+
+// InstallationAccount returns who installed the app. /user does not answer installation tokens, this does
+func (self *AppInstallationTokenSource) InstallationAccount(ctx context.Context) (InstallationAccount, error) {
+
+	var installation struct {
+		Account InstallationAccount `json:"account"`
+	}
+
+	if err := self.requestAsApp(ctx, http.MethodGet, fmt.Sprintf("/app/installations/%d", self.InstallationID), &installation); err != nil {
+		return InstallationAccount{}, fmt.Errorf("could not get the installation %d of the app %s: %w", self.InstallationID, self.AppID, err)
+	}
+
+	return installation.Account, nil
+}
+
+// requestAsApp sends a request authenticated with a JWT of the app, and decodes the json response into response
+func (self *AppInstallationTokenSource) requestAsApp(ctx context.Context, method string, path string, response any) error {
+
+	jwt, err := NewAppJWT(self.AppID, self.PrivateKey, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, method, self.APIBaseURL+path, http.NoBody)
+
+	if err != nil {
+		return err
+	}
+
+	httpRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+	httpRequest.Header.Set("Accept", "application/vnd.github+json")
+	httpRequest.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	httpClient := self.HTTPClient
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	httpResponse, err := httpClient.Do(httpRequest)
+
+	if err != nil {
+		return err
+	}
+
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= 300 {
+		return newAPIError(httpResponse)
+	}
+
+	return json.NewDecoder(httpResponse.Body).Decode(response)
+}
+
+// NewAppJWT signs the JSON Web Token a GitHub App authenticates with, RS256.
+// Issued a minute in the past against clock drift, valid 9 minutes: github refuses more than 10
+func NewAppJWT(appID string, privateKey *rsa.PrivateKey, now time.Time) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParseAppPrivateKey reads the .pem private key github generates for an app, PKCS#1 or PKCS#8
+func ParseAppPrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode(pemBytes)
+
+	if block == nil {
+		return nil, errors.New("no PEM block found in the private key")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the private key: %w", err)
+	}
+
+	privateKey, ok := parsedKey.(*rsa.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("the private key of a GitHub App is an RSA key")
+	}
+
+	return privateKey, nil
+}
@@ -0,0 +1,152 @@
+package ghpm
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JournalEntry : one visibility change that went through
+type JournalEntry struct {
+	Time time.Time `json:"time"`
+
+	// identifies the ghpm invocation that made the change
+	RunID string `json:"run_id"`
+
+	// who made the change, and where. Empty in the entries written before ghpm recorded them
+	APIBaseURL string `json:"api_base_url,omitempty"`
+	Username   string `json:"username,omitempty"`
+
+	Repository string `json:"repository"`
+
+	From Visibility `json:"from"`
+
+	To Visibility `json:"to"`
+
+	// the run this change reverted, when it was made by ghpm undo
+	UndoOf string `json:"undo_of,omitempty"`
+}
+
+// Journal appends JournalEntry to a JSON lines file, so that ghpm undo can replay them backward
+type Journal struct {
+	path string
+
+	runID string
+
+	// set on the journal of ghpm undo, see NewUndoJournal
+	undoOf string
+
+	// switches happen concurrently, lines must not interleave
+	mutex sync.Mutex
+}
+
+func NewJournal(path string, runID string) *Journal {
+	return &Journal{
+		path:  path,
+		runID: runID,
+	}
+}
+
+// NewUndoJournal is NewJournal for the run of ghpm undo that reverts undoneRunID: its entries say so,
+// so that a later ghpm undo does not revert the revert
+func NewUndoJournal(path string, runID string, undoneRunID string) *Journal {
+	return &Journal{
+		path:   path,
+		runID:  runID,
+		undoOf: undoneRunID,
+	}
+}
+
+// NewRunID returns an ID that sorts by time and can't collide between two invocations in the same second
+func NewRunID() string {
+
+	randomBytes := make([]byte, 3)
+
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(randomBytes)
+
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(randomBytes))
+}
+
+func (self *Journal) RunID() string {
+	return self.runID
+}
+
+// Record appends entry, with the time, the run ID and what it undoes filled by the journal
+func (self *Journal) Record(entry JournalEntry) error {
+
+	entry.Time = time.Now().UTC()
+	entry.RunID = self.runID
+	entry.UndoOf = self.undoOf
+
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(self.path), 0o700); err != nil {
+		return err
+	}
+
+	journalFile, err := os.OpenFile(self.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := journalFile.Write(append(line, '\n')); err != nil {
+		journalFile.Close()
+		return err
+	}
+
+	return journalFile.Close()
+}
+
+// ReadJournal returns every entry of the journal at path, oldest first. A missing journal is empty
+func ReadJournal(path string) ([]JournalEntry, error) {
+
+	journalFile, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer journalFile.Close()
+
+	var entries []JournalEntry
+
+	scanner := bufio.NewScanner(journalFile)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d is corrupted: %w", path, lineNumber, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
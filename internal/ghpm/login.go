@@ -1,20 +1,50 @@
 package ghpm
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/Neal-C/ghpm/internal/config"
 	"github.com/cli/oauth"
 )
 
-func LoginToGithubWithDetecFlow() (string, error) {
+// LoginFlow : where and how the OAuth flow runs. The zero value of the optional fields talks to the user in the terminal
+type LoginFlow struct {
+	// root of the web host, https://github.com for example. Serves /login/device/code and /login/oauth/access_token
+	HostURL string
+
+	ClientID string
+
+	ClientSecret string
+
+	// http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// shows the one-time code and where to enter it. When nil, it is printed and Enter is awaited on standard input
+	DisplayCode func(code string, verificationURL string) error
+
+	// when nil, the default browser is opened
+	BrowseURL func(url string) error
+}
+
+// Login runs the device flow, or the web application flow when the host doesn't support it, and returns the token
+func (self LoginFlow) Login() (string, error) {
+
+	httpClient := self.HTTPClient
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
 	flow := &oauth.Flow{
-		Host:         oauth.GitHubHost("https://github.com"),
-		ClientID:     config.OauthClientID,
-		ClientSecret: config.OauthClientSecret,
+		Host:         oauth.GitHubHost(self.HostURL),
+		ClientID:     self.ClientID,
+		ClientSecret: self.ClientSecret,
 		CallbackURI:  config.CallbackURI,
 		Scopes:       config.MinimumScopes,
-		HTTPClient:   http.DefaultClient,
+		HTTPClient:   httpClient,
+		DisplayCode:  self.DisplayCode,
+		BrowseURL:    self.BrowseURL,
 	}
 
 	accessToken, err := flow.DetectFlow()
@@ -25,3 +55,16 @@ func LoginToGithubWithDetecFlow() (string, error) {
 
 	return accessToken.Token, err
 }
+
+// LoginToGithubWithDetecFlow runs the OAuth flow against the given host
+// with the OAuth app identified by clientID and clientSecret
+func LoginToGithubWithDetecFlow(hostname string, clientID string, clientSecret string) (string, error) {
+
+	loginFlow := LoginFlow{
+		HostURL:      fmt.Sprintf("https://%s", hostname),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}
+
+	return loginFlow.Login()
+}
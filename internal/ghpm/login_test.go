@@ -0,0 +1,41 @@
+package ghpm_test
+
+import (
+	"testing"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/Neal-C/ghpm/internal/ghpmtest"
+)
+
+func TestLoginFlow(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.SetPendingDevicePolls(1)
+
+	var displayedCode string
+
+	loginFlow := ghpm.LoginFlow{
+		HostURL:  server.URL,
+		ClientID: "ghpmtest-client",
+		DisplayCode: func(code string, verificationURL string) error {
+			displayedCode = code
+			return nil
+		},
+		BrowseURL: func(url string) error { return nil },
+	}
+
+	token, err := loginFlow.Login()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != server.Token() {
+		t.Errorf("token = %q, want %q", token, server.Token())
+	}
+
+	if displayedCode != ghpmtest.USER_CODE {
+		t.Errorf("displayed code = %q, want %q", displayedCode, ghpmtest.USER_CODE)
+	}
+}
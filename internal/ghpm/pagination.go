@@ -0,0 +1,158 @@
+package ghpm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PER_PAGE : the maximum page size allowed by the github API
+const PER_PAGE = 100
+
+// Repositories iterates over every repository returned by a listing endpoint of the github API,
+// following the Link: rel="next" header until the last page.
+// path is relative to the API root, for example "/user/repos?visibility=public".
+// Iteration stops at the first error, which is yielded
+func (self *GithubPrivacyManager) Repositories(ctx context.Context, path string) iter.Seq2[GithubRepository, error] {
+	return func(yield func(GithubRepository, error) bool) {
+
+		pageEndpoint, err := self.firstPageEndpoint(path)
+
+		if err != nil {
+			yield(GithubRepository{}, err)
+			return
+		}
+
+		for pageEndpoint != "" {
+
+			repositories, nextPageEndpoint, err := self.fetchRepositoriesPage(ctx, pageEndpoint)
+
+			if err != nil {
+				yield(GithubRepository{}, err)
+				return
+			}
+
+			for _, repo := range repositories {
+				if !yield(repo, nil) {
+					return
+				}
+			}
+
+			pageEndpoint = nextPageEndpoint
+		}
+	}
+}
+
+// CollectRepositories drains a Repositories iterator
+func CollectRepositories(repositories iter.Seq2[GithubRepository, error]) ([]GithubRepository, error) {
+
+	var collected []GithubRepository
+
+	for repo, err := range repositories {
+
+		if err != nil {
+			return nil, err
+		}
+
+		collected = append(collected, repo)
+	}
+
+	return collected, nil
+}
+
+// firstPageEndpoint makes path absolute and asks for the biggest pages, to do as few requests as possible
+func (self *GithubPrivacyManager) firstPageEndpoint(path string) (string, error) {
+
+	endpoint, err := url.Parse(self.apiBaseURL + path)
+
+	if err != nil {
+		return "", err
+	}
+
+	query := endpoint.Query()
+
+	if !query.Has("per_page") {
+		query.Set("per_page", fmt.Sprint(PER_PAGE))
+	}
+
+	endpoint.RawQuery = query.Encode()
+
+	return endpoint.String(), nil
+}
+
+func (self *GithubPrivacyManager) fetchRepositoriesPage(ctx context.Context, pageEndpoint string) ([]GithubRepository, string, error) {
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, pageEndpoint, http.NoBody)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	self.setRequiredHeadersOnGithubRequest(httpRequest)
+
+	httpResponse, err := self.httpClient.Do(httpRequest)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("could not list repositories: %w", newAPIError(httpResponse))
+	}
+
+	var page json.RawMessage
+
+	if err := json.NewDecoder(httpResponse.Body).Decode(&page); err != nil {
+		return nil, "", err
+	}
+
+	var repositories []GithubRepository
+
+	// /installation/repositories wraps its page in an object, the other listings answer the array
+	if trimmed := bytes.TrimSpace(page); len(trimmed) > 0 && trimmed[0] == '{' {
+
+		var installationPage struct {
+			Repositories []GithubRepository `json:"repositories"`
+		}
+
+		if err := json.Unmarshal(page, &installationPage); err != nil {
+			return nil, "", err
+		}
+
+		repositories = installationPage.Repositories
+	} else if err := json.Unmarshal(page, &repositories); err != nil {
+		return nil, "", err
+	}
+
+	return repositories, nextPageURL(httpResponse.Header.Get("Link")), nil
+}
+
+// nextPageURL extracts the rel="next" target of a Link header, empty on the last page.
+// example: <https://api.github.com/user/repos?page=2>; rel="next", <https://api.github.com/user/repos?page=5>; rel="last"
+func nextPageURL(linkHeader string) string {
+
+	for _, link := range strings.Split(linkHeader, ",") {
+
+		target, parameters, found := strings.Cut(link, ";")
+
+		if !found {
+			continue
+		}
+
+		for _, parameter := range strings.Split(parameters, ";") {
+
+			if strings.TrimSpace(parameter) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,30 @@
+package ghpm_test
+
+import (
+	"testing"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+func TestNextPageURL(t *testing.T) {
+
+	for _, test := range []struct {
+		name       string
+		linkHeader string
+		want       string
+	}{
+		{"no header", "", ""},
+		{"next and last", `<https://api.github.com/user/repos?page=2>; rel="next", <https://api.github.com/user/repos?page=5>; rel="last"`, "https://api.github.com/user/repos?page=2"},
+		{"next after prev", `<https://api.github.com/user/repos?page=1>; rel="prev", <https://api.github.com/user/repos?page=3>; rel="next"`, "https://api.github.com/user/repos?page=3"},
+		{"last page", `<https://api.github.com/user/repos?page=1>; rel="first", <https://api.github.com/user/repos?page=4>; rel="prev"`, ""},
+		{"without spaces", `<https://ghe.example.com/api/v3/orgs/octo-org/repos?page=2>;rel="next"`, "https://ghe.example.com/api/v3/orgs/octo-org/repos?page=2"},
+		{"malformed", `https://api.github.com/user/repos?page=2`, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+
+			if got := ghpm.NextPageURL(test.linkHeader); got != test.want {
+				t.Errorf("NextPageURL(%q) = %q, want %q", test.linkHeader, got, test.want)
+			}
+		})
+	}
+}
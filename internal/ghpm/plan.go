@@ -0,0 +1,228 @@
+package ghpm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// PLAN_VERSION : bumped whenever the plan file format changes in a way older ghpm can't read
+const PLAN_VERSION = 1
+
+type Visibility string
+
+const (
+	VisibilityPublic  Visibility = "public"
+	VisibilityPrivate Visibility = "private"
+	// visible to every member of the enterprise. Organizations owned by an enterprise only
+	VisibilityInternal Visibility = "internal"
+)
+
+// VisibilityOf returns the visibility of repo, falling back on the private flag for older API versions
+func VisibilityOf(repo GithubRepository) Visibility {
+
+	if repo.Visibility != "" {
+		return Visibility(repo.Visibility)
+	}
+
+	if repo.Private {
+		return VisibilityPrivate
+	}
+
+	return VisibilityPublic
+}
+
+// Plan : an approved list of visibility changes, saved by ghpm plan and replayed by ghpm apply
+type Plan struct {
+	Version int `json:"version"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	// where the plan was made, a plan can't be applied elsewhere
+	APIBaseURL string `json:"api_base_url"`
+
+	Username string `json:"username"`
+
+	Entries []PlanEntry `json:"entries"`
+}
+
+type PlanEntry struct {
+	Repository string `json:"repository"`
+
+	CurrentVisibility Visibility `json:"current_visibility"`
+
+	// same as CurrentVisibility when the repository is skipped
+	TargetVisibility Visibility `json:"target_visibility"`
+
+	// updated_at of the repository when planned. Any change on github since then refuses the entry
+	Fingerprint string `json:"fingerprint"`
+
+	// why the repository is skipped, or what wants it changed
+	Reason string `json:"reason,omitempty"`
+}
+
+// Changes tells whether applying the entry would do anything
+func (self PlanEntry) Changes() bool {
+	return self.CurrentVisibility != self.TargetVisibility
+}
+
+func fingerprintOf(repo GithubRepository) string {
+	return repo.UpdatedAt.UTC().Format(time.RFC3339)
+}
+
+// NewPlanAllRepositoriesToPrivate saves PlanAllRepositoriesToPrivate as a Plan
+func (self *GithubPrivacyManager) NewPlanAllRepositoriesToPrivate(ctx context.Context) (Plan, error) {
+
+	plannedResults, err := self.PlanAllRepositoriesToPrivate(ctx)
+
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{
+		Version:    PLAN_VERSION,
+		CreatedAt:  time.Now().UTC(),
+		APIBaseURL: self.apiBaseURL,
+		Username:   self.username,
+		Entries:    make([]PlanEntry, 0, len(plannedResults)),
+	}
+
+	for _, plannedResult := range plannedResults {
+
+		currentVisibility := VisibilityOf(plannedResult.Repository)
+
+		targetVisibility := currentVisibility
+
+		if plannedResult.Outcome == OutcomePlanned {
+			targetVisibility = VisibilityPrivate
+		}
+
+		plan.Entries = append(plan.Entries, PlanEntry{
+			Repository:        plannedResult.Repository.Fullname,
+			CurrentVisibility: currentVisibility,
+			TargetVisibility:  targetVisibility,
+			Fingerprint:       fingerprintOf(plannedResult.Repository),
+			Reason:            plannedResult.Reason,
+		})
+	}
+
+	return plan, nil
+}
+
+func WritePlan(w io.Writer, plan Plan) error {
+
+	encoder := json.NewEncoder(w)
+
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(plan)
+}
+
+func ReadPlan(r io.Reader) (Plan, error) {
+
+	var plan Plan
+
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return Plan{}, fmt.Errorf("not a ghpm plan: %w", err)
+	}
+
+	if plan.Version != PLAN_VERSION {
+		return Plan{}, fmt.Errorf("plan version %d is not supported by this ghpm, which reads version %d. Plan again", plan.Version, PLAN_VERSION)
+	}
+
+	return plan, nil
+}
+
+// ApplyPlan switches the repositories of the plan that still are as they were when planned.
+// Entries that drifted since are skipped, never switched. Returns one result per entry that changes something
+func (self *GithubPrivacyManager) ApplyPlan(ctx context.Context, plan Plan) ([]SwitchResult, error) {
+
+	if err := self.Authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	if plan.APIBaseURL != self.apiBaseURL || plan.Username != self.username {
+		return nil, fmt.Errorf("the plan was made for %s on %s, not for %s on %s", plan.Username, plan.APIBaseURL, self.username, self.apiBaseURL)
+	}
+
+	var entries []PlanEntry
+
+	for _, entry := range plan.Entries {
+		if entry.Changes() {
+			entries = append(entries, entry)
+		}
+	}
+
+	results := make([]SwitchResult, len(entries))
+
+	// every entry is checked before any is switched, so the ones the token can't change are known up front.
+	// each worker only writes at the index it works on, no lock needed
+	self.forEachConcurrently(len(entries), func(index int) {
+		results[index] = self.refreshPlanEntry(ctx, entries[index])
+	})
+
+	self.switchPlannedResultsTo(ctx, results, func(index int) Visibility { return entries[index].TargetVisibility })
+
+	return results, nil
+}
+
+// refreshPlanEntry fetches the repository of entry again, and tells whether it would still be switched
+func (self *GithubPrivacyManager) refreshPlanEntry(ctx context.Context, entry PlanEntry) SwitchResult {
+
+	repo, err := self.getRepository(ctx, entry.Repository)
+
+	if err != nil {
+		return failedResult(GithubRepository{Fullname: entry.Repository}, err)
+	}
+
+	if currentVisibility := VisibilityOf(repo); currentVisibility != entry.CurrentVisibility {
+		return SwitchResult{Repository: repo, Outcome: OutcomeSkipped, Reason: fmt.Sprintf("drifted since planning: it is now %s, it was %s", currentVisibility, entry.CurrentVisibility)}
+	}
+
+	if fingerprint := fingerprintOf(repo); fingerprint != entry.Fingerprint {
+		return SwitchResult{Repository: repo, Outcome: OutcomeSkipped, Reason: fmt.Sprintf("drifted since planning: updated at %s, it was %s", fingerprint, entry.Fingerprint)}
+	}
+
+	if reason := self.skipReasonFor(repo, entry.TargetVisibility); reason != "" {
+		return protectedResult(repo, reason)
+	}
+
+	return SwitchResult{Repository: repo, Outcome: OutcomePlanned}
+}
+
+// getRepository fetches a repository by its full name, owner/name
+func (self *GithubPrivacyManager) getRepository(ctx context.Context, fullname string) (GithubRepository, error) {
+
+	repositoryEndpoint := fmt.Sprintf("%s/repos/%s", self.apiBaseURL, fullname)
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, repositoryEndpoint, http.NoBody)
+
+	if err != nil {
+		return GithubRepository{}, err
+	}
+
+	self.setRequiredHeadersOnGithubRequest(httpRequest)
+
+	httpResponse, err := self.httpClient.Do(httpRequest)
+
+	if err != nil {
+		return GithubRepository{}, err
+	}
+
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode >= 300 {
+		return GithubRepository{}, fmt.Errorf("could not get repository %s: %w", fullname, newAPIError(httpResponse))
+	}
+
+	var repo GithubRepository
+
+	if err := json.NewDecoder(httpResponse.Body).Decode(&repo); err != nil {
+		return GithubRepository{}, err
+	}
+
+	return repo, nil
+}
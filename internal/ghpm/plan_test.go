@@ -0,0 +1,86 @@
+package ghpm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+func TestApplyPlanRefusesDrift(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	updatedAt := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	fingerprint := updatedAt.Format(time.RFC3339)
+
+	for _, name := range []string{"unchanged", "switched-since", "edited-since", "skipped"} {
+		server.AddRepository(ghpm.GithubRepository{Name: name, UpdatedAt: updatedAt})
+	}
+
+	plan := ghpm.Plan{
+		Version:    ghpm.PLAN_VERSION,
+		APIBaseURL: server.URL,
+		Username:   server.Username(),
+		Entries: []ghpm.PlanEntry{
+			{Repository: "octocat/unchanged", CurrentVisibility: ghpm.VisibilityPublic, TargetVisibility: ghpm.VisibilityPrivate, Fingerprint: fingerprint},
+			// planned while it was private
+			{Repository: "octocat/switched-since", CurrentVisibility: ghpm.VisibilityPrivate, TargetVisibility: ghpm.VisibilityPublic, Fingerprint: fingerprint},
+			{Repository: "octocat/edited-since", CurrentVisibility: ghpm.VisibilityPublic, TargetVisibility: ghpm.VisibilityPrivate, Fingerprint: "2025-06-01T00:00:00Z"},
+			{Repository: "octocat/skipped", CurrentVisibility: ghpm.VisibilityPublic, TargetVisibility: ghpm.VisibilityPublic, Fingerprint: fingerprint},
+		},
+	}
+
+	results, err := manager.ApplyPlan(context.Background(), plan)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("results = %+v, want one per entry that changes something", results)
+	}
+
+	for index, want := range []struct {
+		fullname   string
+		outcome    ghpm.Outcome
+		visibility string
+	}{
+		{"octocat/unchanged", ghpm.OutcomeSwitched, "private"},
+		{"octocat/switched-since", ghpm.OutcomeSkipped, "public"},
+		{"octocat/edited-since", ghpm.OutcomeSkipped, "public"},
+	} {
+
+		if result := results[index]; result.Repository.Fullname != want.fullname || result.Outcome != want.outcome {
+			t.Errorf("result %d = %s %s (%s), want %s %s", index, result.Repository.Fullname, result.Outcome, result.Reason, want.fullname, want.outcome)
+		}
+
+		if repo, _ := server.Repository(want.fullname); repo.Visibility != want.visibility {
+			t.Errorf("server has %s %s, want %s", want.fullname, repo.Visibility, want.visibility)
+		}
+	}
+}
+
+func TestApplyPlanRefusesAnotherAccount(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+
+	plan := ghpm.Plan{
+		Version:    ghpm.PLAN_VERSION,
+		APIBaseURL: server.URL,
+		Username:   "someone-else",
+		Entries:    []ghpm.PlanEntry{{Repository: "octocat/hello", CurrentVisibility: ghpm.VisibilityPublic, TargetVisibility: ghpm.VisibilityPrivate}},
+	}
+
+	if _, err := manager.ApplyPlan(context.Background(), plan); err == nil {
+		t.Error("err = nil, want a plan of another account refused")
+	}
+
+	if repo, _ := server.Repository("octocat/hello"); repo.Private {
+		t.Error("the repository was switched")
+	}
+}
@@ -0,0 +1,50 @@
+package ghpm
+
+import "fmt"
+
+// SetPreflightReport calls report before a bulk switch changes anything, with the repositories the token can't change.
+// They are failed without any request to switch them. report is not called when the token can change everything
+func (self *GithubPrivacyManager) SetPreflightReport(report func(refused []SwitchResult)) {
+	self.preflightReport = report
+}
+
+// cannotChangeReason tells why the token can't change the visibility of repo, empty when it can.
+// Classic tokens were checked for the repo scope by Authenticate. Fine-grained tokens send no scopes: permissions.admin is all there is
+func (self *GithubPrivacyManager) cannotChangeReason(repo GithubRepository) string {
+
+	if repo.Archived {
+		return fmt.Sprintf("%s is archived, so read-only. Unarchive it first", repo.Fullname)
+	}
+
+	// github answers 404 to non admins, which is misleading
+	if !repo.Permissions.Admin {
+		return fmt.Sprintf("the token is not an admin of %s, only admins can change its visibility", repo.Fullname)
+	}
+
+	return ""
+}
+
+// preflight fails the planned results the token can't switch, before anything changes, and reports them all at once.
+// Results it already failed are not reported again
+func (self *GithubPrivacyManager) preflight(results []SwitchResult) {
+
+	var refused []SwitchResult
+
+	for index, result := range results {
+
+		if result.Outcome != OutcomePlanned {
+			continue
+		}
+
+		if reason := self.cannotChangeReason(result.Repository); reason != "" {
+
+			results[index] = failedResult(result.Repository, fmt.Errorf("%s: %w", reason, ErrForbidden))
+
+			refused = append(refused, results[index])
+		}
+	}
+
+	if len(refused) > 0 && self.preflightReport != nil {
+		self.preflightReport(refused)
+	}
+}
@@ -0,0 +1,227 @@
+package ghpm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MAX_RATE_LIMIT_PAUSES : how many times a single request waits for github's rate limit before its answer is returned as is
+const MAX_RATE_LIMIT_PAUSES = 5
+
+// MAX_SENDS_PER_REQUEST : how many times one request is sent at most, rate limit replays and retries together,
+// unless SetMaxAttempts asks for more. See sendBudget
+const MAX_SENDS_PER_REQUEST = MAX_RATE_LIMIT_PAUSES + 1
+
+// SECONDARY_RATE_LIMIT_PAUSE : github documents no reset for secondary rate limits without Retry-After, only to wait at least a minute
+const SECONDARY_RATE_LIMIT_PAUSE = time.Minute
+
+// rateLimitTransport pauses every request when github says the rate limit is reached,
+// and sends again the requests github refused because of it.
+// One pause is shared by all the requests of a GithubPrivacyManager: when one worker is told to wait, they all wait
+type rateLimitTransport struct {
+	base http.RoundTripper
+
+	mutex sync.Mutex
+	// no request is sent before
+	pausedUntil time.Time
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &rateLimitTransport{base: base}
+}
+
+func (self *rateLimitTransport) RoundTrip(httpRequest *http.Request) (*http.Response, error) {
+
+	for pause := 0; ; pause++ {
+
+		if err := self.wait(httpRequest.Context()); err != nil {
+			return nil, err
+		}
+
+		attempt, err := rewindRequest(httpRequest)
+
+		if err != nil {
+			return nil, err
+		}
+
+		takeSend(httpRequest)
+
+		httpResponse, err := self.base.RoundTrip(attempt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		resumeAt, limited := rateLimitResumeTime(httpResponse, time.Now())
+
+		if !resumeAt.IsZero() {
+			self.pauseUntil(resumeAt)
+		}
+
+		// the request itself went through, the pause only concerns the next ones
+		if !limited || pause == MAX_RATE_LIMIT_PAUSES || !canResend(httpRequest) || !hasSendsLeft(httpRequest) {
+			return httpResponse, nil
+		}
+
+		io.Copy(io.Discard, httpResponse.Body)
+		httpResponse.Body.Close()
+	}
+}
+
+// wait blocks until the pause is over, or ctx is done
+func (self *rateLimitTransport) wait(ctx context.Context) error {
+
+	self.mutex.Lock()
+	pausedUntil := self.pausedUntil
+	self.mutex.Unlock()
+
+	delay := time.Until(pausedUntil)
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pauseUntil delays every request until resumeAt. A longer pause that is already set is kept
+func (self *rateLimitTransport) pauseUntil(resumeAt time.Time) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	if !resumeAt.After(self.pausedUntil) {
+		return
+	}
+
+	self.pausedUntil = resumeAt
+
+	log.Printf("github rate limit reached, pausing until %s \n", resumeAt.Local().Format(time.TimeOnly))
+}
+
+// canResend : the body of the request, if any, can be read again
+func canResend(httpRequest *http.Request) bool {
+	return httpRequest.Body == nil || httpRequest.Body == http.NoBody || httpRequest.GetBody != nil
+}
+
+type sendBudgetKey struct{}
+
+// sendBudget : how many more times a request may be sent. Set by the retryTransport, spent by the rateLimitTransport under it,
+// so that retries and rate limit replays don't multiply each other
+type sendBudget struct {
+	remaining int
+}
+
+// withSendBudget limits how many times httpRequest is sent, in total
+func withSendBudget(httpRequest *http.Request, sends int) *http.Request {
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), sendBudgetKey{}, &sendBudget{remaining: sends}))
+}
+
+// takeSend counts one send of httpRequest against its budget, if it has one
+func takeSend(httpRequest *http.Request) {
+
+	if budget, ok := httpRequest.Context().Value(sendBudgetKey{}).(*sendBudget); ok {
+		budget.remaining--
+	}
+}
+
+// hasSendsLeft : httpRequest may be sent again. Requests without budget always may
+func hasSendsLeft(httpRequest *http.Request) bool {
+
+	budget, ok := httpRequest.Context().Value(sendBudgetKey{}).(*sendBudget)
+
+	return !ok || budget.remaining > 0
+}
+
+// rewindRequest returns a request that can be sent, with a fresh body when the request was sent before
+func rewindRequest(httpRequest *http.Request) (*http.Request, error) {
+
+	if httpRequest.Body == nil || httpRequest.Body == http.NoBody || httpRequest.GetBody == nil {
+		return httpRequest, nil
+	}
+
+	body, err := httpRequest.GetBody()
+
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := httpRequest.Clone(httpRequest.Context())
+
+	attempt.Body = body
+
+	return attempt, nil
+}
+
+// rateLimitResumeTime reads the rate limit headers of a github response.
+// resumeAt is when requests may be sent again, zero when there is no need to wait.
+// limited tells that github refused the request because of a rate limit, and that it is worth sending again after resumeAt
+func rateLimitResumeTime(httpResponse *http.Response, now time.Time) (resumeAt time.Time, limited bool) {
+
+	refused := httpResponse.StatusCode == http.StatusTooManyRequests || httpResponse.StatusCode == http.StatusForbidden
+
+	// seconds to wait, sent with secondary rate limits
+	if retryAfter := httpResponse.Header.Get("Retry-After"); retryAfter != "" && refused {
+
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return now.Add(time.Duration(seconds) * time.Second), true
+		}
+
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return date, true
+		}
+	}
+
+	// primary rate limit: no request left until the reset, a unix timestamp
+	if httpResponse.Header.Get("X-RateLimit-Remaining") == "0" {
+
+		if reset, err := strconv.ParseInt(httpResponse.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0), refused
+		}
+	}
+
+	// a 403 is also a plain permission error, only the message tells a secondary rate limit
+	if refused && isSecondaryRateLimitMessage(httpResponse) {
+		return now.Add(SECONDARY_RATE_LIMIT_PAUSE), true
+	}
+
+	return time.Time{}, false
+}
+
+// isSecondaryRateLimitMessage peeks into the body of the response, and puts it back for the caller to read
+func isSecondaryRateLimitMessage(httpResponse *http.Response) bool {
+
+	body, err := io.ReadAll(httpResponse.Body)
+
+	httpResponse.Body.Close()
+
+	httpResponse.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
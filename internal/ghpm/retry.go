@@ -0,0 +1,156 @@
+package ghpm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// DEFAULT_MAX_ATTEMPTS : how many times a request is sent at most, the first time included
+const DEFAULT_MAX_ATTEMPTS = 4
+
+// FIRST_RETRY_DELAY doubles at every retry, up to MAX_RETRY_DELAY. The actual delay is a random part of it
+const (
+	FIRST_RETRY_DELAY = time.Second
+	MAX_RETRY_DELAY   = 30 * time.Second
+)
+
+// retryTransport sends again the requests that failed for reasons that usually go away: a github 5xx,
+// a rate limit the rateLimitTransport under it could not wait out, a connection error.
+// Only idempotent requests are sent again, see markIdempotent
+type retryTransport struct {
+	base http.RoundTripper
+
+	// below 1 means DEFAULT_MAX_ATTEMPTS
+	maxAttempts int
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{base: base, maxAttempts: DEFAULT_MAX_ATTEMPTS}
+}
+
+// SetMaxAttempts sets how many times a request is sent at most when github fails, the first time included.
+// 1 disables retries, below 1 means DEFAULT_MAX_ATTEMPTS
+func (self *GithubPrivacyManager) SetMaxAttempts(maxAttempts int) {
+	self.retryTransport.maxAttempts = maxAttempts
+}
+
+type idempotentRequestKey struct{}
+
+// markIdempotent allows the retryTransport to send a request again when its method is not idempotent by definition,
+// like the PATCH of a visibility: sending the same visibility twice changes nothing more than sending it once
+func markIdempotent(httpRequest *http.Request) *http.Request {
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), idempotentRequestKey{}, true))
+}
+
+func isIdempotent(httpRequest *http.Request) bool {
+
+	switch httpRequest.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	marked, _ := httpRequest.Context().Value(idempotentRequestKey{}).(bool)
+
+	return marked
+}
+
+func (self *retryTransport) RoundTrip(httpRequest *http.Request) (*http.Response, error) {
+
+	maxAttempts := self.maxAttempts
+
+	if maxAttempts < 1 {
+		maxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+
+	// a body that can't be read again can't be sent again
+	if !isIdempotent(httpRequest) || !canResend(httpRequest) {
+		maxAttempts = 1
+	}
+
+	httpRequest = withSendBudget(httpRequest, max(maxAttempts, MAX_SENDS_PER_REQUEST))
+
+	for attempt := 1; ; attempt++ {
+
+		attemptRequest, err := rewindRequest(httpRequest)
+
+		if err != nil {
+			return nil, err
+		}
+
+		httpResponse, err := self.base.RoundTrip(attemptRequest)
+
+		if attempt == maxAttempts || !hasSendsLeft(httpRequest) || !isTransientFailure(httpRequest.Context(), httpResponse, err) {
+			return httpResponse, err
+		}
+
+		var failure string
+
+		if err != nil {
+			failure = err.Error()
+		} else {
+			failure = httpResponse.Status
+
+			io.Copy(io.Discard, httpResponse.Body)
+			httpResponse.Body.Close()
+		}
+
+		delay := retryDelay(attempt)
+
+		log.Printf("%s %s: %s, attempt %d of %d, retrying in %s \n", httpRequest.Method, httpRequest.URL.Path, failure, attempt, maxAttempts, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-httpRequest.Context().Done():
+
+			timer.Stop()
+
+			return nil, httpRequest.Context().Err()
+		}
+	}
+}
+
+// isTransientFailure tells whether sending the same request again may go better
+func isTransientFailure(ctx context.Context, httpResponse *http.Response, err error) bool {
+
+	if err != nil {
+		// the caller gave up, not github
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch {
+	case httpResponse.StatusCode >= 500:
+		return true
+
+	case httpResponse.StatusCode == http.StatusTooManyRequests:
+		return true
+
+	case httpResponse.StatusCode == http.StatusForbidden:
+
+		// a 403 is also a plain permission error, that no retry fixes
+		_, limited := rateLimitResumeTime(httpResponse, time.Now())
+
+		return limited
+	}
+
+	return false
+}
+
+// retryDelay : exponential backoff with full jitter, a random delay below FIRST_RETRY_DELAY * 2^(attempt-1), capped by MAX_RETRY_DELAY.
+// The jitter keeps the workers from all coming back at the same time
+func retryDelay(attempt int) time.Duration {
+
+	ceiling := MAX_RETRY_DELAY
+
+	if attempt < 16 {
+		ceiling = min(FIRST_RETRY_DELAY<<(attempt-1), MAX_RETRY_DELAY)
+	}
+
+	return rand.N(ceiling) + 1
+}
@@ -0,0 +1,118 @@
+package ghpm
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RepositorySelector picks repositories out of a listing by name.
+// A repository is selected when any glob or any regular expression matches it
+type RepositorySelector struct {
+	globs []string
+
+	regexps []*regexp.Regexp
+}
+
+// NewRepositorySelector validates every pattern upfront.
+// Globs match the repository name, or owner/name when they contain a /. Regular expressions match either
+func NewRepositorySelector(globs []string, regularExpressions []string) (RepositorySelector, error) {
+
+	selector := RepositorySelector{globs: globs}
+
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return RepositorySelector{}, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+
+	for _, regularExpression := range regularExpressions {
+
+		compiled, err := regexp.Compile(regularExpression)
+
+		if err != nil {
+			return RepositorySelector{}, fmt.Errorf("invalid regular expression %q: %w", regularExpression, err)
+		}
+
+		selector.regexps = append(selector.regexps, compiled)
+	}
+
+	return selector, nil
+}
+
+// IsEmpty tells whether the selector has no pattern at all, and so selects nothing
+func (self RepositorySelector) IsEmpty() bool {
+	return len(self.globs) == 0 && len(self.regexps) == 0
+}
+
+func (self RepositorySelector) Matches(repo GithubRepository) bool {
+
+	for _, glob := range self.globs {
+
+		subject := repo.Name
+
+		if strings.Contains(glob, "/") {
+			subject = repo.Fullname
+		}
+
+		// the pattern was validated by NewRepositorySelector
+		if matched, _ := path.Match(glob, subject); matched {
+			return true
+		}
+	}
+
+	for _, compiled := range self.regexps {
+		if compiled.MatchString(repo.Name) || compiled.MatchString(repo.Fullname) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SelectRepositories fetches the repositories given by name (see RepositoryFullname),
+// and the ones of the listing (yours, or the organization's) matched by selector. Each repository appears once
+func (self *GithubPrivacyManager) SelectRepositories(ctx context.Context, repositoryNames []string, selector RepositorySelector) ([]GithubRepository, error) {
+
+	if err := self.Authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	var selected []GithubRepository
+
+	seen := map[string]bool{}
+
+	for _, repositoryName := range repositoryNames {
+
+		repo, err := self.getRepository(ctx, self.RepositoryFullname(repositoryName))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[strings.ToLower(repo.Fullname)] {
+			seen[strings.ToLower(repo.Fullname)] = true
+			selected = append(selected, repo)
+		}
+	}
+
+	if selector.IsEmpty() {
+		return selected, nil
+	}
+
+	for repo, err := range self.ownedRepositories(ctx, "all") {
+
+		if err != nil {
+			return nil, err
+		}
+
+		if selector.Matches(repo) && !seen[strings.ToLower(repo.Fullname)] {
+			seen[strings.ToLower(repo.Fullname)] = true
+			selected = append(selected, repo)
+		}
+	}
+
+	return selected, nil
+}
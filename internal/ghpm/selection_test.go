@@ -0,0 +1,100 @@
+package ghpm_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+func TestRepositorySelector(t *testing.T) {
+
+	experiment := ghpm.GithubRepository{Name: "hello-experiment", Fullname: "octocat/hello-experiment"}
+	advent := ghpm.GithubRepository{Name: "aoc-2023", Fullname: "octocat/aoc-2023"}
+	site := ghpm.GithubRepository{Name: "site", Fullname: "octo-org/site"}
+
+	for _, test := range []struct {
+		name               string
+		globs              []string
+		regularExpressions []string
+		want               []ghpm.GithubRepository
+	}{
+		{name: "no pattern selects nothing"},
+		{name: "glob on the name", globs: []string{"*-experiment"}, want: []ghpm.GithubRepository{experiment}},
+		{name: "glob with a / on owner/name", globs: []string{"octo-org/*"}, want: []ghpm.GithubRepository{site}},
+		{name: "glob without / ignores the owner", globs: []string{"octo*"}},
+		{name: "regular expression on the name", regularExpressions: []string{"^aoc-20[0-9]{2}$"}, want: []ghpm.GithubRepository{advent}},
+		{name: "regular expression on owner/name", regularExpressions: []string{"^octo-org/"}, want: []ghpm.GithubRepository{site}},
+		{name: "any pattern selects", globs: []string{"site"}, regularExpressions: []string{"experiment"}, want: []ghpm.GithubRepository{experiment, site}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+
+			selector, err := ghpm.NewRepositorySelector(test.globs, test.regularExpressions)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if selector.IsEmpty() != (len(test.globs) == 0 && len(test.regularExpressions) == 0) {
+				t.Errorf("IsEmpty = %t", selector.IsEmpty())
+			}
+
+			var got []ghpm.GithubRepository
+
+			for _, repo := range []ghpm.GithubRepository{experiment, advent, site} {
+				if selector.Matches(repo) {
+					got = append(got, repo)
+				}
+			}
+
+			if !slices.Equal(slices.Collect(ghpm.ToFullname(got)), slices.Collect(ghpm.ToFullname(test.want))) {
+				t.Errorf("selected %v, want %v", slices.Collect(ghpm.ToFullname(got)), slices.Collect(ghpm.ToFullname(test.want)))
+			}
+		})
+	}
+}
+
+func TestNewRepositorySelectorRefusesInvalidPatterns(t *testing.T) {
+
+	if _, err := ghpm.NewRepositorySelector([]string{"[a"}, nil); err == nil {
+		t.Error("err = nil, want the glob refused")
+	}
+
+	if _, err := ghpm.NewRepositorySelector(nil, []string{"(a"}); err == nil {
+		t.Error("err = nil, want the regular expression refused")
+	}
+}
+
+func TestSelectRepositories(t *testing.T) {
+
+	server, manager := newTestManager(t)
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Name: "a-experiment"})
+	server.AddRepository(ghpm.GithubRepository{Name: "b-experiment", Private: true})
+	server.AddRepository(ghpm.GithubRepository{Fullname: "octo-org/c-experiment"})
+
+	selector, err := ghpm.NewRepositorySelector([]string{"*-experiment"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// named first, in order, then matched in listing order. Each repository once, whatever the case of its name
+	selected, err := manager.SelectRepositories(context.Background(), []string{"hello", "octo-org/c-experiment", "A-Experiment"}, selector)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"octocat/hello", "octo-org/c-experiment", "octocat/a-experiment", "octocat/b-experiment"}
+
+	if got := slices.Collect(ghpm.ToFullname(selected)); !slices.Equal(got, want) {
+		t.Errorf("selected %v, want %v", got, want)
+	}
+
+	if _, err := manager.SelectRepositories(context.Background(), []string{"missing"}, selector); err == nil {
+		t.Error("err = nil, want a repository named but missing refused")
+	}
+}
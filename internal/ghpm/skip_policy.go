@@ -0,0 +1,48 @@
+package ghpm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SkipPolicy : which repositories ghpm refuses to switch to private.
+// Switching a starred repository to private loses its stars, and detaches its forks: it can't be undone
+type SkipPolicy struct {
+	// repositories with more stars than this are skipped
+	MaxStars uint `json:"max_stars"`
+
+	// forks are skipped unless true
+	IncludeForks bool `json:"include_forks"`
+
+	// the profile README repository (username/username) is skipped unless true
+	AllowReadmeRepository bool `json:"allow_readme_repository"`
+}
+
+// DefaultSkipPolicy : skip any starred repository, any fork, and the profile README repository
+func DefaultSkipPolicy() SkipPolicy {
+	return SkipPolicy{
+		MaxStars:              0,
+		IncludeForks:          false,
+		AllowReadmeRepository: false,
+	}
+}
+
+// SkipReason tells why repo must not be switched to private by username. Empty when it can be
+func (self SkipPolicy) SkipReason(repo GithubRepository, username string) string {
+
+	readmeRepository := fmt.Sprintf("%s/%s", username, username)
+
+	if !self.AllowReadmeRepository && strings.EqualFold(repo.Fullname, readmeRepository) {
+		return "special repository: your profile's README. Allow it with --allow-readme-repo"
+	}
+
+	if repo.Stars > self.MaxStars {
+		return fmt.Sprintf("it has %d stars, more than the maximum of %d. Raise it with --max-stars", repo.Stars, self.MaxStars)
+	}
+
+	if !self.IncludeForks && repo.IsFork {
+		return "it's a fork. Include forks with --include-forks"
+	}
+
+	return ""
+}
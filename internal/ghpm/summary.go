@@ -0,0 +1,85 @@
+package ghpm
+
+import "errors"
+
+// SummaryStatus : how a bulk switch went as a whole
+type SummaryStatus string
+
+const (
+	// nothing failed and nothing was refused. Skipped repositories are not failures
+	SummaryStatusSuccess SummaryStatus = "success"
+	// some repositories failed, others were switched
+	SummaryStatusPartialFailure SummaryStatus = "partial_failure"
+	// repositories failed or were refused, and none was switched
+	SummaryStatusTotalFailure SummaryStatus = "total_failure"
+)
+
+// SwitchSummary : the results of a bulk switch, by outcome. Each list keeps the order of the results
+type SwitchSummary struct {
+	Switched []SwitchResult
+
+	Skipped []SwitchResult
+
+	Failed []SwitchResult
+
+	// left as is on purpose although they were named explicitly, see RefuseNamed. They count as failures
+	Refused []SwitchResult
+}
+
+// NewSwitchSummary sorts results by outcome. Planned results, from dry runs, changed nothing and are left out
+func NewSwitchSummary(results []SwitchResult) SwitchSummary {
+
+	var summary SwitchSummary
+
+	for _, result := range results {
+
+		switch result.Outcome {
+		case OutcomeSwitched:
+			summary.Switched = append(summary.Switched, result)
+		case OutcomeSkipped:
+			summary.Skipped = append(summary.Skipped, result)
+		case OutcomeFailed:
+			summary.Failed = append(summary.Failed, result)
+		}
+	}
+
+	return summary
+}
+
+// RefuseNamed moves to Refused the repositories named tells were asked for by name, and that ghpm left as is on purpose
+// (an ErrProtectedRepository). Repositories selected in bulk, by a pattern or a rule, stay skipped: leaving some out is expected
+func (self SwitchSummary) RefuseNamed(named func(SwitchResult) bool) SwitchSummary {
+
+	skipped := self.Skipped
+
+	self.Skipped = nil
+
+	for _, result := range skipped {
+
+		var protectedRepository ErrProtectedRepository
+
+		if errors.As(result.Err, &protectedRepository) && named(result) {
+			self.Refused = append(self.Refused, result)
+		} else {
+			self.Skipped = append(self.Skipped, result)
+		}
+	}
+
+	return self
+}
+
+func (self SwitchSummary) Total() int {
+	return len(self.Switched) + len(self.Skipped) + len(self.Failed) + len(self.Refused)
+}
+
+func (self SwitchSummary) Status() SummaryStatus {
+
+	switch {
+	case len(self.Failed) == 0 && len(self.Refused) == 0:
+		return SummaryStatusSuccess
+	case len(self.Switched) == 0:
+		return SummaryStatusTotalFailure
+	default:
+		return SummaryStatusPartialFailure
+	}
+}
@@ -0,0 +1,104 @@
+package ghpm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// TokenSource : where a GithubPrivacyManager gets the token of each request from.
+// StaticToken for personal access tokens, DeviceFlowTokenSource for an interactive login,
+// AppInstallationTokenSource to act as a GitHub App installation
+type TokenSource interface {
+	// Token returns a token valid for the request about to be sent. Called before every request
+	Token(ctx context.Context) (string, error)
+}
+
+// InstallationTokenSource : a TokenSource acting as a GitHub App installation, that /user does not answer.
+// Authenticate asks it who the installation belongs to instead. A source wrapping an AppInstallationTokenSource,
+// to cache or log its tokens for example, implements it by forwarding InstallationAccount
+type InstallationTokenSource interface {
+	TokenSource
+
+	InstallationAccount(ctx context.Context) (InstallationAccount, error)
+}
+
+// StaticToken : a token that never changes. Classic and fine-grained personal access tokens, or a token stored by ghpm login.
+// Fine-grained tokens need the Administration (read and write) and Metadata (read) repository permissions
+type StaticToken string
+
+func (self StaticToken) Token(ctx context.Context) (string, error) {
+	return string(self), nil
+}
+
+// DeviceFlowTokenSource logs in with Flow the first time a token is needed, and keeps the token
+type DeviceFlowTokenSource struct {
+	Flow LoginFlow
+
+	// called with the new token, to store it for the next runs. Optional
+	OnLogin func(token string) error
+
+	mutex sync.Mutex
+
+	token string
+}
+
+func (self *DeviceFlowTokenSource) Token(ctx context.Context) (string, error) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	if self.token != "" {
+		return self.token, nil
+	}
+
+	token, err := self.Flow.Login()
+
+	if err != nil {
+		return "", fmt.Errorf("login failed: %w", err)
+	}
+
+	if self.OnLogin != nil {
+		if err := self.OnLogin(token); err != nil {
+			return "", err
+		}
+	}
+
+	self.token = token
+
+	return token, nil
+}
+
+// authTransport sets the Authorization header of every request from a TokenSource
+type authTransport struct {
+	base http.RoundTripper
+
+	tokenSource TokenSource
+}
+
+func newAuthTransport(base http.RoundTripper, tokenSource TokenSource) *authTransport {
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &authTransport{base: base, tokenSource: tokenSource}
+}
+
+func (self *authTransport) RoundTrip(httpRequest *http.Request) (*http.Response, error) {
+
+	token, err := self.tokenSource.Token(httpRequest.Context())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request it was given
+	authenticatedRequest := httpRequest.Clone(httpRequest.Context())
+
+	authenticatedRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	return self.base.RoundTrip(authenticatedRequest)
+}
@@ -0,0 +1,250 @@
+package ghpm_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+	"github.com/Neal-C/ghpm/internal/ghpmtest"
+)
+
+func newTestInstallation(t *testing.T, server *ghpmtest.Server) *ghpm.AppInstallationTokenSource {
+
+	privateKey, err := ghpm.ParseAppPrivateKey(server.AppPrivateKey())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &ghpm.AppInstallationTokenSource{
+		AppID:          ghpmtest.APP_ID,
+		InstallationID: ghpmtest.INSTALLATION_ID,
+		PrivateKey:     privateKey,
+		APIBaseURL:     server.URL,
+		HTTPClient:     server.Client(),
+	}
+}
+
+func TestAppInstallation(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.AddRepository(ghpm.GithubRepository{
+		Fullname:    ghpmtest.APP_ORGANIZATION + "/site",
+		Permissions: ghpm.RepositoryPermissions{Admin: true},
+	})
+
+	manager, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, newTestInstallation(t, server), server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manager.Username() != ghpmtest.APP_ORGANIZATION {
+		t.Errorf("username = %q, want the organization the app is installed on", manager.Username())
+	}
+
+	if _, known := manager.Scopes(); known {
+		t.Error("installation tokens have no scopes")
+	}
+
+	// a bare name targets the organization of the installation
+	result := manager.SwitchRepositoryByName(context.Background(), "site", ghpm.VisibilityPrivate)
+
+	if result.Outcome != ghpm.OutcomeSwitched {
+		t.Fatalf("outcome = %s (%s), want switched", result.Outcome, result.Reason)
+	}
+
+	if slices.Contains(server.Requests(), "GET /user") {
+		t.Error("/user was requested, github does not answer it to installations")
+	}
+}
+
+func TestAppInstallationOnUserAccount(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	server.SetInstallationAccount(ghpmtest.USERNAME, "User")
+
+	server.AddRepository(ghpm.GithubRepository{Name: "hello"})
+	server.AddRepository(ghpm.GithubRepository{Name: "secret", Private: true})
+	server.AddRepository(ghpm.GithubRepository{Fullname: "octo-org/site"})
+
+	manager, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, newTestInstallation(t, server), server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// /user/repos does not answer installation tokens
+	repositories, err := manager.ListAllPublicRepositories(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := slices.Collect(ghpm.ToFullname(repositories)); !slices.Equal(got, []string{"octocat/hello"}) {
+		t.Errorf("listed %v, want the public repositories of the user the app is installed on", got)
+	}
+}
+
+// countingInstallation wraps an installation, as a caller caching or logging its tokens would
+type countingInstallation struct {
+	installation *ghpm.AppInstallationTokenSource
+
+	tokens int
+}
+
+func (self *countingInstallation) Token(ctx context.Context) (string, error) {
+
+	self.tokens++
+
+	return self.installation.Token(ctx)
+}
+
+func (self *countingInstallation) InstallationAccount(ctx context.Context) (ghpm.InstallationAccount, error) {
+	return self.installation.InstallationAccount(ctx)
+}
+
+func TestWrappedAppInstallation(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	source := &countingInstallation{installation: newTestInstallation(t, server)}
+
+	manager, err := ghpm.NewGithubPrivacyManager(context.Background(), server.URL, source, server.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manager.Username() != ghpmtest.APP_ORGANIZATION {
+		t.Errorf("username = %q, want the organization the app is installed on", manager.Username())
+	}
+
+	if slices.Contains(server.Requests(), "GET /user") || source.tokens == 0 {
+		t.Errorf("requests = %v, want the installation authenticated through the wrapper, without /user", server.Requests())
+	}
+}
+
+func TestAppInstallationTokenIsReused(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	installation := newTestInstallation(t, server)
+
+	first, err := installation.Token(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := installation.Token(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second || server.InstallationTokens() != 1 {
+		t.Errorf("got %q then %q, %d tokens issued, want one token reused", first, second, server.InstallationTokens())
+	}
+}
+
+func TestAppInstallationTokenIsRefreshedBeforeExpiry(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	// expires within REFRESH_BEFORE_EXPIRY as soon as issued
+	server.SetInstallationTokenLifetime(time.Minute)
+
+	installation := newTestInstallation(t, server)
+
+	first, err := installation.Token(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := installation.Token(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second || server.InstallationTokens() != 2 {
+		t.Errorf("got %q then %q, %d tokens issued, want a new token", first, second, server.InstallationTokens())
+	}
+}
+
+func TestAppInstallationWrongPrivateKey(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	installation := newTestInstallation(t, server)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installation.PrivateKey = otherKey
+
+	_, err = ghpm.NewGithubPrivacyManager(context.Background(), server.URL, installation, server.Client())
+
+	if !errors.Is(err, ghpm.ErrUnauthorized) {
+		t.Errorf("err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestDeviceFlowTokenSourceLogsInOnce(t *testing.T) {
+
+	server := ghpmtest.NewServer(t)
+
+	var storedToken string
+
+	tokenSource := &ghpm.DeviceFlowTokenSource{
+		Flow: ghpm.LoginFlow{
+			HostURL:     server.URL,
+			ClientID:    "ghpmtest-client",
+			HTTPClient:  server.Client(),
+			DisplayCode: func(code string, verificationURL string) error { return nil },
+			BrowseURL:   func(url string) error { return nil },
+		},
+		OnLogin: func(token string) error {
+			storedToken = token
+			return nil
+		},
+	}
+
+	manager := ghpm.NewLazyGithubPrivacyManager(server.URL, tokenSource, server.Client())
+
+	if _, err := manager.ListAllPublicRepositories(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.ListAllPublicRepositories(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if storedToken != server.Token() {
+		t.Errorf("stored token = %q, want %q", storedToken, server.Token())
+	}
+
+	logins := 0
+
+	for _, request := range server.Requests() {
+		if request == "POST /login/device/code" {
+			logins++
+		}
+	}
+
+	if logins != 1 {
+		t.Errorf("%d logins, want 1", logins)
+	}
+}
@@ -0,0 +1,291 @@
+package ghpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleAction : what a rule of the visibility policy wants for the repositories it matches
+type RuleAction string
+
+const (
+	RuleActionPrivate RuleAction = "private"
+	RuleActionPublic  RuleAction = "public"
+	// organizations owned by an enterprise only
+	RuleActionInternal RuleAction = "internal"
+	// leave the repository as it is
+	RuleActionIgnore RuleAction = "ignore"
+)
+
+// VisibilityPolicy : the desired visibility of repositories, usually read from ghpm.yaml.
+// Rules are evaluated in order, the first one that matches a repository decides
+type VisibilityPolicy struct {
+	Rules []VisibilityRule `yaml:"rules"`
+
+	// applies to repositories no rule matches. ignore when empty
+	Default RuleAction `yaml:"default"`
+}
+
+type VisibilityRule struct {
+	// optional, shown as the reason of the decision
+	Name string `yaml:"name"`
+
+	Match RuleMatch `yaml:"match"`
+
+	Visibility RuleAction `yaml:"visibility"`
+}
+
+// RuleMatch : every condition that is set must hold for the rule to match. No condition matches everything
+type RuleMatch struct {
+	// glob on the repository name, or on owner/name when it contains a /
+	Name string `yaml:"name"`
+
+	// the repository has this topic
+	Topic string `yaml:"topic"`
+
+	// primary language, case insensitive
+	Language string `yaml:"language"`
+
+	Archived *bool `yaml:"archived"`
+
+	Fork *bool `yaml:"fork"`
+
+	MinStars *uint `yaml:"min_stars"`
+
+	MaxStars *uint `yaml:"max_stars"`
+
+	// last push is older than this. Go durations plus d (days), w (weeks) and y (365 days): 90d, 2y
+	NotPushedFor Age `yaml:"not_pushed_for"`
+}
+
+// Age is a time.Duration that can be written in days, weeks or years in ghpm.yaml
+type Age time.Duration
+
+func (self *Age) UnmarshalYAML(node *yaml.Node) error {
+
+	age, err := ParseAge(node.Value)
+
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+
+	*self = age
+
+	return nil
+}
+
+// ParseAge parses 90d, 2w, 1y, or anything time.ParseDuration understands
+func ParseAge(text string) (Age, error) {
+
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+
+	for suffix, unit := range units {
+
+		if count, found := strings.CutSuffix(text, suffix); found {
+
+			parsedCount, err := strconv.ParseUint(count, 10, 32)
+
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %q, expected for example 90d, 2w, 1y or 720h", text)
+			}
+
+			return Age(time.Duration(parsedCount) * unit), nil
+		}
+	}
+
+	duration, err := time.ParseDuration(text)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q, expected for example 90d, 2w, 1y or 720h", text)
+	}
+
+	return Age(duration), nil
+}
+
+// ParseVisibilityPolicy reads a ghpm.yaml. Unknown keys are errors, a typo must not silently match everything
+func ParseVisibilityPolicy(r io.Reader) (VisibilityPolicy, error) {
+
+	decoder := yaml.NewDecoder(r)
+
+	decoder.KnownFields(true)
+
+	var policy VisibilityPolicy
+
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return VisibilityPolicy{}, err
+	}
+
+	if policy.Default == "" {
+		policy.Default = RuleActionIgnore
+	}
+
+	if !isRuleAction(policy.Default) {
+		return VisibilityPolicy{}, fmt.Errorf("default: unknown visibility %q, expected private, public, internal or ignore", policy.Default)
+	}
+
+	for index, rule := range policy.Rules {
+
+		if !isRuleAction(rule.Visibility) {
+			return VisibilityPolicy{}, fmt.Errorf("rule %s: unknown visibility %q, expected private, public, internal or ignore", rule.label(index), rule.Visibility)
+		}
+
+		if _, err := path.Match(rule.Match.Name, ""); err != nil {
+			return VisibilityPolicy{}, fmt.Errorf("rule %s: invalid name glob %q: %w", rule.label(index), rule.Match.Name, err)
+		}
+	}
+
+	return policy, nil
+}
+
+func isRuleAction(action RuleAction) bool {
+	return slices.Contains([]RuleAction{RuleActionPrivate, RuleActionPublic, RuleActionInternal, RuleActionIgnore}, action)
+}
+
+// label names the rule in errors and reasons: its name, or its position
+func (self VisibilityRule) label(index int) string {
+
+	if self.Name != "" {
+		return fmt.Sprintf("#%d (%s)", index+1, self.Name)
+	}
+
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// Evaluate returns the action of the first rule matching repo, and which rule it was
+func (self VisibilityPolicy) Evaluate(repo GithubRepository, now time.Time) (RuleAction, string) {
+
+	for index, rule := range self.Rules {
+		if rule.Match.matches(repo, now) {
+			return rule.Visibility, fmt.Sprintf("rule %s", rule.label(index))
+		}
+	}
+
+	return self.Default, "no rule matches, default"
+}
+
+func (self RuleMatch) matches(repo GithubRepository, now time.Time) bool {
+
+	if self.Name != "" {
+
+		subject := repo.Name
+
+		if strings.Contains(self.Name, "/") {
+			subject = repo.Fullname
+		}
+
+		// the pattern was validated by ParseVisibilityPolicy
+		if matched, _ := path.Match(self.Name, subject); !matched {
+			return false
+		}
+	}
+
+	if self.Topic != "" && !slices.Contains(repo.Topics, self.Topic) {
+		return false
+	}
+
+	if self.Language != "" && !strings.EqualFold(self.Language, repo.Language) {
+		return false
+	}
+
+	if self.Archived != nil && *self.Archived != repo.Archived {
+		return false
+	}
+
+	if self.Fork != nil && *self.Fork != repo.IsFork {
+		return false
+	}
+
+	if self.MinStars != nil && repo.Stars < *self.MinStars {
+		return false
+	}
+
+	if self.MaxStars != nil && repo.Stars > *self.MaxStars {
+		return false
+	}
+
+	// a repository that was never pushed to is as old as it gets
+	if self.NotPushedFor != 0 && !repo.PushedAt.IsZero() && now.Sub(repo.PushedAt) < time.Duration(self.NotPushedFor) {
+		return false
+	}
+
+	return true
+}
+
+// NewReconcilePlan diffs the policy against every repository you own, or of the organization.
+// Repositories the policy wants private still go through the skip policy
+func (self *GithubPrivacyManager) NewReconcilePlan(ctx context.Context, policy VisibilityPolicy) (Plan, error) {
+
+	if err := self.Authenticate(ctx); err != nil {
+		return Plan{}, err
+	}
+
+	ownedRepositories, err := CollectRepositories(self.ownedRepositories(ctx, "all"))
+
+	if err != nil {
+		return Plan{}, err
+	}
+
+	now := time.Now()
+
+	plan := Plan{
+		Version:    PLAN_VERSION,
+		CreatedAt:  now.UTC(),
+		APIBaseURL: self.apiBaseURL,
+		Username:   self.username,
+		Entries:    make([]PlanEntry, 0, len(ownedRepositories)),
+	}
+
+	for _, repo := range ownedRepositories {
+
+		currentVisibility := VisibilityOf(repo)
+
+		entry := PlanEntry{
+			Repository:        repo.Fullname,
+			CurrentVisibility: currentVisibility,
+			TargetVisibility:  currentVisibility,
+			Fingerprint:       fingerprintOf(repo),
+		}
+
+		action, rule := policy.Evaluate(repo, now)
+
+		switch {
+		case action == RuleActionIgnore:
+
+			entry.Reason = fmt.Sprintf("%s: ignore", rule)
+
+		case Visibility(action) == currentVisibility:
+
+			entry.Reason = fmt.Sprintf("%s: already %s", rule, currentVisibility)
+
+		case self.skipReasonFor(repo, Visibility(action)) != "":
+
+			entry.Reason = fmt.Sprintf("%s wants it %s, but %s", rule, action, self.skipReasonFor(repo, Visibility(action)))
+
+		case self.cannotChangeReason(repo) != "":
+
+			entry.Reason = fmt.Sprintf("%s wants it %s, but %s", rule, action, self.cannotChangeReason(repo))
+
+		default:
+
+			entry.TargetVisibility = Visibility(action)
+			entry.Reason = rule
+		}
+
+		plan.Entries = append(plan.Entries, entry)
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,157 @@
+package ghpm_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+func TestParseAge(t *testing.T) {
+
+	day := 24 * time.Hour
+
+	for _, test := range []struct {
+		text    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{text: "90d", want: 90 * day},
+		{text: "2w", want: 14 * day},
+		{text: "1y", want: 365 * day},
+		{text: "720h", want: 720 * time.Hour},
+		{text: "1h30m", want: 90 * time.Minute},
+		{text: "d", wantErr: true},
+		{text: "-3d", wantErr: true},
+		{text: "1.5y", wantErr: true},
+		{text: "soon", wantErr: true},
+		{text: "", wantErr: true},
+	} {
+		t.Run(test.text, func(t *testing.T) {
+
+			age, err := ghpm.ParseAge(test.text)
+
+			if test.wantErr {
+
+				if err == nil {
+					t.Errorf("ParseAge(%q) = %s, want an error", test.text, time.Duration(age))
+				}
+
+				return
+			}
+
+			if err != nil || time.Duration(age) != test.want {
+				t.Errorf("ParseAge(%q) = %s, %v, want %s", test.text, time.Duration(age), err, test.want)
+			}
+		})
+	}
+}
+
+func TestParseVisibilityPolicy(t *testing.T) {
+
+	for _, test := range []struct {
+		name string
+		yaml string
+		// substring of the error, none expected when empty
+		wantErr string
+	}{
+		{name: "empty file ignores everything", yaml: ""},
+		{name: "rules and default", yaml: "rules:\n  - name: showcase\n    match:\n      topic: showcase\n    visibility: public\ndefault: private\n"},
+		{name: "every condition", yaml: "rules:\n  - match:\n      name: \"octocat/*\"\n      language: go\n      archived: false\n      fork: false\n      min_stars: 1\n      max_stars: 10\n      not_pushed_for: 2y\n    visibility: private\n"},
+		{name: "unknown key", yaml: "rules:\n  - match:\n      nmae: \"*\"\n    visibility: private\n", wantErr: "nmae"},
+		{name: "unknown visibility", yaml: "rules:\n  - name: typo\n    match:\n      name: \"*\"\n    visibility: privat\n", wantErr: `rule #1 (typo): unknown visibility "privat"`},
+		{name: "missing visibility", yaml: "rules:\n  - match:\n      name: \"*\"\n", wantErr: "rule #1: unknown visibility"},
+		{name: "unknown default", yaml: "default: hidden\n", wantErr: `default: unknown visibility "hidden"`},
+		{name: "invalid glob", yaml: "rules:\n  - match:\n      name: \"[a\"\n    visibility: private\n", wantErr: "invalid name glob"},
+		{name: "invalid age", yaml: "rules:\n  - match:\n      not_pushed_for: ages\n    visibility: private\n", wantErr: `line 3: invalid age "ages"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+
+			policy, err := ghpm.ParseVisibilityPolicy(strings.NewReader(test.yaml))
+
+			if test.wantErr == "" {
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if policy.Default == "" {
+					t.Error("default is empty, want ignore at least")
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+
+	policy, err := ghpm.ParseVisibilityPolicy(strings.NewReader(`
+rules:
+  - name: showcase stays public
+    match:
+      topic: showcase
+    visibility: public
+  - name: hide experiments
+    match:
+      name: "*-experiment"
+    visibility: private
+  - name: organization forks
+    match:
+      name: "octo-org/*"
+      fork: true
+    visibility: internal
+  - match:
+      language: go
+      min_stars: 2
+      max_stars: 5
+    visibility: public
+  - name: hide what's abandoned
+    match:
+      archived: false
+      not_pushed_for: 1y
+    visibility: private
+default: ignore
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	recently := now.AddDate(0, -1, 0)
+
+	for _, test := range []struct {
+		name       string
+		repo       ghpm.GithubRepository
+		wantAction ghpm.RuleAction
+		wantRule   string
+	}{
+		{"first matching rule wins", ghpm.GithubRepository{Name: "a-experiment", Topics: []string{"showcase"}, PushedAt: recently}, ghpm.RuleActionPublic, "rule #1 (showcase stays public)"},
+		{"name glob", ghpm.GithubRepository{Name: "a-experiment", PushedAt: recently}, ghpm.RuleActionPrivate, "rule #2 (hide experiments)"},
+		{"owner/name glob and fork", ghpm.GithubRepository{Name: "site", Fullname: "octo-org/site", IsFork: true, PushedAt: recently}, ghpm.RuleActionInternal, "rule #3 (organization forks)"},
+		{"owner/name glob, not a fork", ghpm.GithubRepository{Name: "site", Fullname: "octo-org/site", PushedAt: recently}, ghpm.RuleActionIgnore, "no rule matches, default"},
+		{"language is case insensitive, stars in range", ghpm.GithubRepository{Name: "tool", Language: "Go", Stars: 5, PushedAt: recently}, ghpm.RuleActionPublic, "rule #4"},
+		{"too many stars", ghpm.GithubRepository{Name: "tool", Language: "Go", Stars: 6, PushedAt: recently}, ghpm.RuleActionIgnore, "no rule matches, default"},
+		{"too few stars", ghpm.GithubRepository{Name: "tool", Language: "Go", Stars: 1, PushedAt: recently}, ghpm.RuleActionIgnore, "no rule matches, default"},
+		{"not pushed for long", ghpm.GithubRepository{Name: "old", PushedAt: now.AddDate(-2, 0, 0)}, ghpm.RuleActionPrivate, "rule #5 (hide what's abandoned)"},
+		{"never pushed", ghpm.GithubRepository{Name: "empty"}, ghpm.RuleActionPrivate, "rule #5 (hide what's abandoned)"},
+		{"archived", ghpm.GithubRepository{Name: "old", Archived: true, PushedAt: now.AddDate(-2, 0, 0)}, ghpm.RuleActionIgnore, "no rule matches, default"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+
+			action, rule := policy.Evaluate(test.repo, now)
+
+			if action != test.wantAction || rule != test.wantRule {
+				t.Errorf("Evaluate = %s, %q, want %s, %q", action, rule, test.wantAction, test.wantRule)
+			}
+		})
+	}
+}
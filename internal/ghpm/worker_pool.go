@@ -0,0 +1,50 @@
+package ghpm
+
+import "sync"
+
+// DEFAULT_CONCURRENCY : how many repositories are switched at the same time by default.
+// Github's secondary rate limits forbid hammering it, more rarely goes faster
+const DEFAULT_CONCURRENCY = 8
+
+// SetConcurrency bounds how many repositories bulk switches and plans work on at the same time.
+// Below 1 means DEFAULT_CONCURRENCY
+func (self *GithubPrivacyManager) SetConcurrency(concurrency int) {
+	self.concurrency = concurrency
+}
+
+// forEachConcurrently calls work for every index below count, from at most self.concurrency goroutines.
+// A cancelled context fails the requests of the remaining work, so each index still gets its result
+func (self *GithubPrivacyManager) forEachConcurrently(count int, work func(index int)) {
+
+	concurrency := self.concurrency
+
+	if concurrency < 1 {
+		concurrency = DEFAULT_CONCURRENCY
+	}
+
+	indexes := make(chan int)
+
+	var workersWaitGroup sync.WaitGroup
+
+	for range min(concurrency, count) {
+
+		workersWaitGroup.Add(1)
+
+		go func() {
+
+			defer workersWaitGroup.Done()
+
+			for index := range indexes {
+				work(index)
+			}
+		}()
+	}
+
+	for index := range count {
+		indexes <- index
+	}
+
+	close(indexes)
+
+	workersWaitGroup.Wait()
+}
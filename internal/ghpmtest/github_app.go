@@ -0,0 +1,235 @@
+package ghpmtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+// Defaults of the GitHub App the server knows, see AppPrivateKey
+const (
+	APP_ID          = "424242"
+	INSTALLATION_ID = 4242
+	// the organization the app is installed on
+	APP_ORGANIZATION = "octo-org"
+	// how long github keeps installation tokens valid
+	INSTALLATION_TOKEN_LIFETIME = time.Hour
+)
+
+// githubApp : the GitHub App APP_ID, installed once, on installationAccount
+type githubApp struct {
+	privateKey *rsa.PrivateKey
+
+	installationAccount ghpm.InstallationAccount
+
+	tokenLifetime time.Duration
+
+	// the installation tokens issued so far, and when they expire
+	tokens map[string]time.Time
+}
+
+// AppPrivateKey returns the PEM private key of the GitHub App APP_ID, installed as INSTALLATION_ID on APP_ORGANIZATION.
+// The key is generated by the first call, servers that don't need the app don't pay for it
+func (self *Server) AppPrivateKey() []byte {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(self.githubApp().privateKey)})
+}
+
+// SetInstallationTokenLifetime shortens the installation tokens, to test their refresh
+func (self *Server) SetInstallationTokenLifetime(lifetime time.Duration) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.githubApp().tokenLifetime = lifetime
+}
+
+// SetInstallationAccount changes where the app is installed. accountType is User or Organization
+func (self *Server) SetInstallationAccount(login string, accountType string) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.githubApp().installationAccount = ghpm.InstallationAccount{Login: login, Type: accountType}
+}
+
+// InstallationTokens returns how many installation tokens were issued
+func (self *Server) InstallationTokens() int {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	if self.app == nil {
+		return 0
+	}
+
+	return len(self.app.tokens)
+}
+
+// githubApp returns the app, created on first use. The mutex must be held
+func (self *Server) githubApp() *githubApp {
+
+	if self.app != nil {
+		return self.app
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		panic(fmt.Sprintf("ghpmtest: could not generate the private key of the app: %s", err))
+	}
+
+	self.app = &githubApp{
+		privateKey:          privateKey,
+		installationAccount: ghpm.InstallationAccount{Login: APP_ORGANIZATION, Type: "Organization"},
+		tokenLifetime:       INSTALLATION_TOKEN_LIFETIME,
+		tokens:              map[string]time.Time{},
+	}
+
+	return self.app
+}
+
+// isInstallationToken : authorization carries an installation token that did not expire
+func (self *Server) isInstallationToken(authorization string) bool {
+
+	if self.app == nil {
+		return false
+	}
+
+	expiresAt, found := self.app.tokens[strings.TrimPrefix(authorization, "Bearer ")]
+
+	return found && time.Now().Before(expiresAt)
+}
+
+// serveApp answers the endpoints a GitHub App authenticates to with a JWT. Only INSTALLATION_ID exists
+func (self *Server) serveApp(w http.ResponseWriter, r *http.Request, segments []string) {
+
+	if self.app == nil {
+
+		writeError(w, http.StatusNotFound, "Not Found")
+
+		return
+	}
+
+	if err := verifyAppJWT(r.Header.Get("Authorization"), &self.app.privateKey.PublicKey); err != nil {
+
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("A JSON web token could not be decoded: %s", err))
+
+		return
+	}
+
+	if len(segments) < 3 || segments[2] != strconv.Itoa(INSTALLATION_ID) {
+
+		writeError(w, http.StatusNotFound, "Not Found")
+
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 3:
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": INSTALLATION_ID, "account": self.app.installationAccount})
+
+	case r.Method == http.MethodPost && len(segments) == 4 && segments[3] == "access_tokens":
+
+		token := fmt.Sprintf("ghs_ghpmtest_%d", len(self.app.tokens)+1)
+
+		expiresAt := time.Now().Add(self.app.tokenLifetime).UTC().Truncate(time.Second)
+
+		self.app.tokens[token] = expiresAt
+
+		writeJSON(w, http.StatusCreated, map[string]any{"token": token, "expires_at": expiresAt})
+
+	default:
+
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// verifyAppJWT checks the RS256 signature and the claims github checks: issued by APP_ID, not expired, valid 10 minutes at most
+func verifyAppJWT(authorization string, publicKey *rsa.PublicKey) error {
+
+	jwt, found := strings.CutPrefix(authorization, "Bearer ")
+
+	if !found {
+		return errors.New("missing bearer token")
+	}
+
+	parts := strings.Split(jwt, ".")
+
+	if len(parts) != 3 {
+		return errors.New("not a JWT")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Algorithm != "RS256" {
+		return errors.New("the algorithm must be RS256")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return errors.New("invalid signature")
+	}
+
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return err
+	}
+
+	switch {
+	case claims.Issuer != APP_ID:
+		return fmt.Errorf("unknown issuer %q", claims.Issuer)
+	case time.Now().Unix() >= claims.ExpiresAt:
+		return errors.New("expired")
+	case claims.ExpiresAt-claims.IssuedAt > int64((10 * time.Minute).Seconds()):
+		return errors.New("'Expiration time' claim ('exp') is too far in the future")
+	}
+
+	return nil
+}
+
+func decodeJWTPart(part string, value any) error {
+
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, value)
+}
@@ -0,0 +1,615 @@
+// package for a fake github, to test ghpm offline
+package ghpmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Neal-C/ghpm/internal/ghpm"
+)
+
+// Defaults of NewServer
+const (
+	USERNAME = "octocat"
+	TOKEN    = "ghpmtest-token"
+	// the device code flow answers it, see LoginFlow
+	USER_CODE = "GHPM-TEST"
+	// what github allows per hour to a token
+	RATE_LIMIT = 5000
+	// what github answers to per_page=100 and above
+	MAX_PER_PAGE = 100
+)
+
+// Server : an in-memory github, serving the REST endpoints ghpm uses, the OAuth device flow and a GitHub App, see AppPrivateKey.
+// Point a ghpm.GithubPrivacyManager at Server.URL. Safe for concurrent use
+type Server struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+
+	// login of the authenticated user
+	username string
+	// accepted in the Authorization header
+	token string
+	// sent in X-OAuth-Scopes. nil sends no header, like fine-grained tokens
+	scopes []string
+
+	// in the order they were added, which is the order of the listings
+	repositories []ghpm.GithubRepository
+
+	faults []fault
+
+	perPage int
+
+	rateLimitRemaining int
+	rateLimitReset     time.Time
+
+	// how many times the token endpoint answers authorization_pending before granting the token
+	pendingDevicePolls int
+
+	// nil until AppPrivateKey or another method of the app is called
+	app *githubApp
+
+	requests []string
+}
+
+// Fault : an error answered instead of the real response. See InjectFault
+type Fault struct {
+	Status int
+
+	// the message of the json error body, http.StatusText(Status) when empty
+	Message string
+
+	// added to the response, Retry-After for example
+	Header http.Header
+
+	// how many matching requests get the fault, 1 when 0
+	Times int
+}
+
+type fault struct {
+	method string
+	path   string
+	Fault
+}
+
+// NewServer starts a fake github for USERNAME, accepting TOKEN with the repo scope. It is closed at the end of the test
+func NewServer(t testing.TB) *Server {
+
+	server := &Server{
+		username:           USERNAME,
+		token:              TOKEN,
+		scopes:             []string{"repo"},
+		perPage:            MAX_PER_PAGE,
+		rateLimitRemaining: RATE_LIMIT,
+		rateLimitReset:     time.Now().Add(time.Hour),
+	}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Username returns the login of the authenticated user
+func (self *Server) Username() string {
+	return self.username
+}
+
+// Token returns the token the server accepts
+func (self *Server) Token() string {
+	return self.token
+}
+
+// SetScopes sets what X-OAuth-Scopes answers. nil removes the header, like github does for fine-grained tokens
+func (self *Server) SetScopes(scopes []string) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.scopes = scopes
+}
+
+// SetPerPage lowers the page size, to test pagination without hundreds of repositories
+func (self *Server) SetPerPage(perPage int) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.perPage = perPage
+}
+
+// SetRateLimit sets how many requests are left until reset. At 0, requests are refused with a 403 until reset
+func (self *Server) SetRateLimit(remaining int, reset time.Time) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.rateLimitRemaining = remaining
+	self.rateLimitReset = reset
+}
+
+// SetPendingDevicePolls makes the device flow answer authorization_pending polls times before granting the token
+func (self *Server) SetPendingDevicePolls(polls int) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.pendingDevicePolls = polls
+}
+
+// AddRepository stores repo. Only Fullname, or Name for a repository of the user, is required:
+// the owner, the visibility, the admin permission and the dates are filled from it
+func (self *Server) AddRepository(repo ghpm.GithubRepository) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	if repo.Fullname == "" {
+		repo.Fullname = fmt.Sprintf("%s/%s", self.username, repo.Name)
+	}
+
+	owner, name, _ := strings.Cut(repo.Fullname, "/")
+
+	repo.Name = name
+
+	if repo.Owner.Login == "" {
+		repo.Owner.Login = owner
+	}
+
+	if repo.Owner.Type == "" {
+
+		repo.Owner.Type = "Organization"
+
+		if strings.EqualFold(owner, self.username) {
+			repo.Owner.Type = "User"
+			repo.Permissions = ghpm.RepositoryPermissions{Admin: true, Push: true, Pull: true}
+		}
+	}
+
+	if repo.Visibility == "" {
+		repo.Visibility = string(ghpm.VisibilityPublic)
+
+		if repo.Private {
+			repo.Visibility = string(ghpm.VisibilityPrivate)
+		}
+	}
+
+	repo.Private = repo.Visibility != string(ghpm.VisibilityPublic)
+
+	if repo.UpdatedAt.IsZero() {
+		repo.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+
+	if repo.CreatedAt.IsZero() {
+		repo.CreatedAt = repo.UpdatedAt
+	}
+
+	self.repositories = append(self.repositories, repo)
+}
+
+// Repository returns the stored repository, as changed by the requests
+func (self *Server) Repository(fullname string) (ghpm.GithubRepository, bool) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	index := self.repositoryIndex(fullname)
+
+	if index == -1 {
+		return ghpm.GithubRepository{}, false
+	}
+
+	return self.repositories[index], true
+}
+
+func (self *Server) repositoryIndex(fullname string) int {
+	return slices.IndexFunc(self.repositories, func(repo ghpm.GithubRepository) bool { return strings.EqualFold(repo.Fullname, fullname) })
+}
+
+// InjectFault answers fault to the next requests with method on path, /repos/octocat/hello for example.
+// Faults are answered before authentication and rate limits
+func (self *Server) InjectFault(method string, path string, injected Fault) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	if injected.Times == 0 {
+		injected.Times = 1
+	}
+
+	self.faults = append(self.faults, fault{method: method, path: path, Fault: injected})
+}
+
+// Requests returns the requests received so far, as "METHOD /path"
+func (self *Server) Requests() []string {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	return slices.Clone(self.requests)
+}
+
+func (self *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+
+	self.mutex.Lock()
+
+	defer self.mutex.Unlock()
+
+	self.requests = append(self.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+	if self.answerFault(w, r) {
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/login/device/code":
+
+		self.serveDeviceCode(w, r)
+
+		return
+
+	case r.Method == http.MethodPost && r.URL.Path == "/login/oauth/access_token":
+
+		self.serveAccessToken(w, r)
+
+		return
+	}
+
+	if !self.answerRateLimit(w) {
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// authenticated with a JWT of the app, not a token
+	if len(segments) >= 2 && segments[0] == "app" && segments[1] == "installations" {
+
+		self.serveApp(w, r, segments)
+
+		return
+	}
+
+	authorization := r.Header.Get("Authorization")
+
+	installation := self.isInstallationToken(authorization)
+
+	if !installation && authorization != "Bearer "+self.token && authorization != "token "+self.token {
+
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+
+		return
+	}
+
+	// installation tokens have permissions, not scopes
+	if self.scopes != nil && !installation {
+		w.Header().Set("X-OAuth-Scopes", strings.Join(self.scopes, ", "))
+	}
+
+	switch {
+	case r.Method == http.MethodGet && (r.URL.Path == "/user" || r.URL.Path == "/user/repos") && installation:
+
+		writeError(w, http.StatusForbidden, "Resource not accessible by integration")
+
+	case r.Method == http.MethodGet && r.URL.Path == "/installation/repositories" && installation:
+
+		// the installation has access to every repository of its account
+		account := self.app.installationAccount.Login
+
+		self.serveInstallationListing(w, r, func(repo ghpm.GithubRepository) bool {
+			return strings.EqualFold(repo.Owner.Login, account)
+		})
+
+	case r.Method == http.MethodGet && r.URL.Path == "/user":
+
+		writeJSON(w, http.StatusOK, ghpm.User{Username: self.username})
+
+	case r.Method == http.MethodGet && r.URL.Path == "/user/repos":
+
+		// without affiliation=owner, github also lists the repositories the user collaborates on or sees through an organization.
+		// The user is taken to see every repository of the server
+		ownedOnly := r.URL.Query().Get("affiliation") == "owner"
+
+		self.serveListing(w, r, func(repo ghpm.GithubRepository) bool {
+			return (!ownedOnly || strings.EqualFold(repo.Owner.Login, self.username)) && matchesVisibility(repo, r.URL.Query().Get("visibility"))
+		})
+
+	case r.Method == http.MethodGet && len(segments) == 3 && segments[0] == "orgs" && segments[2] == "repos":
+
+		self.serveListing(w, r, func(repo ghpm.GithubRepository) bool {
+			return strings.EqualFold(repo.Owner.Login, segments[1]) && matchesVisibility(repo, r.URL.Query().Get("type"))
+		})
+
+	case len(segments) == 3 && segments[0] == "repos":
+
+		self.serveRepository(w, r, segments[1]+"/"+segments[2])
+
+	default:
+
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// answerFault answers the first injected fault matching r, if any
+func (self *Server) answerFault(w http.ResponseWriter, r *http.Request) bool {
+
+	index := slices.IndexFunc(self.faults, func(fault fault) bool { return fault.method == r.Method && fault.path == r.URL.Path })
+
+	if index == -1 {
+		return false
+	}
+
+	injected := self.faults[index]
+
+	self.faults[index].Times--
+
+	if self.faults[index].Times == 0 {
+		self.faults = slices.Delete(self.faults, index, index+1)
+	}
+
+	for name, values := range injected.Header {
+		w.Header()[name] = values
+	}
+
+	message := injected.Message
+
+	if message == "" {
+		message = http.StatusText(injected.Status)
+	}
+
+	writeError(w, injected.Status, message)
+
+	return true
+}
+
+// answerRateLimit sets the rate limit headers, and refuses the request when none is left
+func (self *Server) answerRateLimit(w http.ResponseWriter) bool {
+
+	if !time.Now().Before(self.rateLimitReset) {
+		self.rateLimitRemaining = RATE_LIMIT
+		self.rateLimitReset = time.Now().Add(time.Hour)
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(RATE_LIMIT))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(self.rateLimitReset.Unix(), 10))
+
+	if self.rateLimitRemaining <= 0 {
+
+		w.Header().Set("X-RateLimit-Remaining", "0")
+
+		writeError(w, http.StatusForbidden, "API rate limit exceeded")
+
+		return false
+	}
+
+	self.rateLimitRemaining--
+
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(self.rateLimitRemaining))
+
+	return true
+}
+
+// serveListing answers one page of the repositories kept by keep, with a Link header to the next one
+func (self *Server) serveListing(w http.ResponseWriter, r *http.Request, keep func(ghpm.GithubRepository) bool) {
+
+	page, _ := self.listingPage(w, r, keep)
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// serveInstallationListing is serveListing for /installation/repositories, which wraps the page in an object
+func (self *Server) serveInstallationListing(w http.ResponseWriter, r *http.Request, keep func(ghpm.GithubRepository) bool) {
+
+	page, total := self.listingPage(w, r, keep)
+
+	writeJSON(w, http.StatusOK, map[string]any{"total_count": total, "repositories": page})
+}
+
+// listingPage returns the page of the repositories kept by keep that r asks for, and how many were kept.
+// It sets the Link header to the next page
+func (self *Server) listingPage(w http.ResponseWriter, r *http.Request, keep func(ghpm.GithubRepository) bool) ([]ghpm.GithubRepository, int) {
+
+	var kept []ghpm.GithubRepository
+
+	for _, repo := range self.repositories {
+		if keep(repo) {
+			kept = append(kept, repo)
+		}
+	}
+
+	query := r.URL.Query()
+
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+
+	if err != nil || perPage < 1 {
+		perPage = 30
+	}
+
+	perPage = min(perPage, self.perPage)
+
+	page, err := strconv.Atoi(query.Get("page"))
+
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	start := min((page-1)*perPage, len(kept))
+	end := min(start+perPage, len(kept))
+
+	if end < len(kept) {
+
+		query.Set("page", strconv.Itoa(page+1))
+
+		next := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	// an empty page is [], not null
+	return append([]ghpm.GithubRepository{}, kept[start:end]...), len(kept)
+}
+
+func (self *Server) serveRepository(w http.ResponseWriter, r *http.Request, fullname string) {
+
+	index := self.repositoryIndex(fullname)
+
+	if index == -1 {
+
+		writeError(w, http.StatusNotFound, "Not Found")
+
+		return
+	}
+
+	repo := &self.repositories[index]
+
+	switch r.Method {
+	case http.MethodGet:
+
+		writeJSON(w, http.StatusOK, repo)
+
+	case http.MethodPatch:
+
+		var payload struct {
+			Visibility string `json:"visibility"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+
+			return
+		}
+
+		if !repo.Permissions.Admin {
+
+			writeError(w, http.StatusNotFound, "Not Found")
+
+			return
+		}
+
+		if repo.Archived {
+
+			writeError(w, http.StatusForbidden, "Repository was archived so is read-only.")
+
+			return
+		}
+
+		validVisibilities := []string{string(ghpm.VisibilityPublic), string(ghpm.VisibilityPrivate)}
+
+		if repo.Owner.Type == "Organization" {
+			validVisibilities = append(validVisibilities, string(ghpm.VisibilityInternal))
+		}
+
+		if !slices.Contains(validVisibilities, payload.Visibility) {
+
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+
+			return
+		}
+
+		if payload.Visibility != repo.Visibility {
+			repo.Visibility = payload.Visibility
+			repo.Private = payload.Visibility != string(ghpm.VisibilityPublic)
+			repo.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+		}
+
+		writeJSON(w, http.StatusOK, repo)
+
+	default:
+
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// serveDeviceCode starts the device flow. Answers are form encoded, like github does without Accept: application/json
+func (self *Server) serveDeviceCode(w http.ResponseWriter, r *http.Request) {
+
+	writeForm(w, url.Values{
+		"device_code":      {"ghpmtest-device-code"},
+		"user_code":        {USER_CODE},
+		"verification_uri": {self.URL + "/login/device"},
+		"expires_in":       {"900"},
+		// polls right away, tests don't wait
+		"interval": {"0"},
+	})
+}
+
+func (self *Server) serveAccessToken(w http.ResponseWriter, r *http.Request) {
+
+	if r.PostFormValue("device_code") != "ghpmtest-device-code" {
+
+		writeForm(w, url.Values{"error": {"incorrect_device_code"}, "error_description": {"The device_code provided is not valid."}})
+
+		return
+	}
+
+	if self.pendingDevicePolls > 0 {
+
+		self.pendingDevicePolls--
+
+		writeForm(w, url.Values{"error": {"authorization_pending"}})
+
+		return
+	}
+
+	writeForm(w, url.Values{"access_token": {self.token}, "token_type": {"bearer"}, "scope": {strings.Join(self.scopes, ",")}})
+}
+
+// matchesVisibility filters on the visibility, type or affiliation query parameter of the listings
+func matchesVisibility(repo ghpm.GithubRepository, visibility string) bool {
+
+	switch visibility {
+	case "", "all":
+		return true
+	case "forks":
+		return repo.IsFork
+	case "sources":
+		return !repo.IsFork
+	}
+
+	return repo.Visibility == visibility
+}
+
+// writeError answers the json body github sends with errors
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeForm(w http.ResponseWriter, values url.Values) {
+
+	w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w.WriteHeader(http.StatusOK)
+
+	w.Write([]byte(values.Encode()))
+}